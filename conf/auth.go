@@ -0,0 +1,33 @@
+package conf
+
+import (
+	"os"
+	"strings"
+)
+
+/*
+Auth Configurations
+*/
+
+func getJWTSecret() string {
+	if ENV == ENV_PROD {
+		return getSSMKey("EVENTS_JWT_SECRET_PROD")
+	} else if strings.HasPrefix(ENV, ENV_UAT) {
+		return getSSMKey("EVENTS_JWT_SECRET_UAT")
+	}
+
+	return os.Getenv("EVENTS_JWT_SECRET")
+}
+
+func getJWKSPath() string {
+	if path := os.Getenv("EVENTS_JWKS_PATH"); path != "" {
+		return path
+	}
+
+	return "config/jwks.json"
+}
+
+var AuthConf = map[string]interface{}{
+	"HMACSecret": getJWTSecret(),
+	"JWKSPath":   getJWKSPath(),
+}
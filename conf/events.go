@@ -0,0 +1,183 @@
+package conf
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Event Sink Configurations
+*/
+
+func getEventSink() string {
+	if sink := os.Getenv("EVENTS_SINK"); sink != "" {
+		return sink
+	}
+
+	if ENV == ENV_LOCAL || ENV == "" {
+		return "stdout"
+	}
+
+	return "kafka"
+}
+
+func getKafkaBrokers() []string {
+	if brokers := os.Getenv("EVENTS_KAFKA_BROKERS"); brokers != "" {
+		return strings.Split(brokers, ",")
+	}
+
+	if ENV == ENV_PROD {
+		return strings.Split(getSSMKey("KAFKA_BROKERS_PROD"), ",")
+	} else if strings.HasPrefix(ENV, ENV_UAT) {
+		return strings.Split(getSSMKey("KAFKA_BROKERS_UAT"), ",")
+	} else if strings.HasPrefix(ENV, ENV_DEV) {
+		return []string{"kafka:9093"}
+	}
+
+	return []string{"localhost:9092"}
+}
+
+func getKafkaTopic() string {
+	if topic := os.Getenv("EVENTS_KAFKA_TOPIC"); topic != "" {
+		return topic
+	}
+
+	return "quickstart-events"
+}
+
+func getEventsFilePath() string {
+	if path := os.Getenv("EVENTS_FILE_PATH"); path != "" {
+		return path
+	}
+
+	return "logs/events.ndjson"
+}
+
+// getWALDir returns the directory of the write-ahead log batches go through
+// before the sink, an empty dir disables it
+func getWALDir() string {
+	if dir, ok := os.LookupEnv("EVENTS_WAL_DIR"); ok {
+		return dir
+	}
+
+	return "data/wal"
+}
+
+func getWALMaxBytes() int64 {
+	if value, err := strconv.ParseInt(os.Getenv("EVENTS_WAL_MAX_BYTES"), 10, 64); err == nil {
+		return value
+	}
+
+	return 1 << 30 // 1 GiB
+}
+
+func getWALMaxAge() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("EVENTS_WAL_MAX_AGE")); err == nil {
+		return value
+	}
+
+	return time.Hour * 24 * 7 // 1 week
+}
+
+func getDeadLetterSink() string {
+	if sink := os.Getenv("EVENTS_DLQ_SINK"); sink != "" {
+		return sink
+	}
+
+	if ENV == ENV_LOCAL || ENV == "" {
+		return "file"
+	}
+
+	return "kafka"
+}
+
+func getDeadLetterKafkaTopic() string {
+	if topic := os.Getenv("EVENTS_DLQ_KAFKA_TOPIC"); topic != "" {
+		return topic
+	}
+
+	return getKafkaTopic() + "-dlq"
+}
+
+func getDeadLetterFilePath() string {
+	if path := os.Getenv("EVENTS_DLQ_FILE_PATH"); path != "" {
+		return path
+	}
+
+	return "logs/dead-letters.ndjson"
+}
+
+func getDeliveryAttempts() int {
+	if value, err := strconv.Atoi(os.Getenv("EVENTS_DELIVERY_ATTEMPTS")); err == nil && value > 0 {
+		return value
+	}
+
+	return 5
+}
+
+// getSchemaDir returns the directory of the event JSON schemas, named <event_type>.v<version>.json
+func getSchemaDir() string {
+	if dir := os.Getenv("EVENTS_SCHEMA_DIR"); dir != "" {
+		return dir
+	}
+
+	return "config/schemas"
+}
+
+// getSchemaRequired tells whether events of a type without a schema are rejected
+func getSchemaRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("EVENTS_SCHEMA_REQUIRED"))
+	return required
+}
+
+// getPartitionKeys returns the dotted paths of the event fields the kafka
+// partition key is read from, in order of preference
+func getPartitionKeys() []string {
+	if keys := os.Getenv("EVENTS_PARTITION_KEYS"); keys != "" {
+		return strings.Split(keys, ",")
+	}
+
+	return []string{"loan_meta_data.loan_application_id", "loan_meta_data.customer_id", "user"}
+}
+
+// getPositiveInt reads a positive int from the env, falling back to def
+func getPositiveInt(key string, def int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+
+	return def
+}
+
+func getBatchInterval() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("EVENTS_BATCH_INTERVAL")); err == nil && value > 0 {
+		return value
+	}
+
+	return time.Second * 5
+}
+
+var EventsConf = map[string]interface{}{
+	"Sink":             getEventSink(),
+	"KafkaBrokers":     getKafkaBrokers(),
+	"KafkaTopic":       getKafkaTopic(),
+	"FilePath":         getEventsFilePath(),
+	"WALDir":           getWALDir(),
+	"WALSegmentSize":   int64(16 << 20), // 16 MiB
+	"WALMaxBytes":      getWALMaxBytes(),
+	"WALMaxAge":        getWALMaxAge(),
+	"DLQSink":          getDeadLetterSink(),
+	"DLQKafkaTopic":    getDeadLetterKafkaTopic(),
+	"DLQFilePath":      getDeadLetterFilePath(),
+	"DeliveryAttempts": getDeliveryAttempts(),
+	"SchemaDir":        getSchemaDir(),
+	"SchemaRequired":   getSchemaRequired(),
+	"PartitionKeys":    getPartitionKeys(),
+	"BatchMaxEvents":   getPositiveInt("EVENTS_BATCH_MAX_EVENTS", 100),
+	"BatchMaxBytes":    getPositiveInt("EVENTS_BATCH_MAX_BYTES", 1<<20), // 1 MiB
+	"BatchInterval":    getBatchInterval(),
+	"BatchWorkers":     getPositiveInt("EVENTS_BATCH_WORKERS", 4),
+	"QueueSize":        getPositiveInt("EVENTS_QUEUE_SIZE", 100),
+}
@@ -0,0 +1,78 @@
+package conf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Notification Consumer Configurations
+*/
+
+// NotificationRuleConf maps the kafka messages it matches to the websocket
+// clients they are delivered to, see config/notifications.yaml
+type NotificationRuleConf struct {
+	Name     string            `yaml:"name"`
+	Topic    string            `yaml:"topic"`
+	Match    map[string]string `yaml:"match"`
+	Target   string            `yaml:"target"`
+	Field    string            `yaml:"field"`
+	Channel  string            `yaml:"channel"`
+	OrgField string            `yaml:"org_field"`
+	Payload  string            `yaml:"payload"`
+}
+
+// getNotificationConsumer tells whether the notification topics are consumed
+func getNotificationConsumer() bool {
+	if consumer, err := strconv.ParseBool(os.Getenv("EVENTS_NOTIFICATION_CONSUMER")); err == nil {
+		return consumer
+	}
+
+	return false
+}
+
+// getNotificationGroupID returns the consumer group the instances share, the
+// relay hands every message to the instances holding its connections
+func getNotificationGroupID() string {
+	if groupID := os.Getenv("EVENTS_NOTIFICATION_GROUP_ID"); groupID != "" {
+		return groupID
+	}
+
+	return "go-event-management-notifications"
+}
+
+func getNotificationRulesPath() string {
+	if path := os.Getenv("EVENTS_NOTIFICATION_RULES_PATH"); path != "" {
+		return path
+	}
+
+	return "config/notifications.yaml"
+}
+
+// getNotificationRules reads the delivery rules, nothing is consumed when there are none
+func getNotificationRules() []NotificationRuleConf {
+	b, err := os.ReadFile(getNotificationRulesPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		panic("couldn't read from notifications.yaml: " + err.Error())
+	}
+	rules := []NotificationRuleConf{}
+	err = yaml.Unmarshal(b, &rules)
+	if err != nil {
+		panic("couldn't unmarshal from notifications.yaml: " + err.Error())
+	}
+	return rules
+}
+
+var NotificationsConf = map[string]interface{}{
+	"Consumer": getNotificationConsumer(),
+	"GroupID":  getNotificationGroupID(),
+}
+
+var NotificationRulesConf = getNotificationRules()
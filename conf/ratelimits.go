@@ -0,0 +1,52 @@
+package conf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Websocket Rate Limit Configurations
+*/
+
+// LimitConf is a token bucket, refilled with rate tokens per second up to burst
+type LimitConf struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// RateLimitConf holds the limits of a user type, see config/ratelimits.yaml
+type RateLimitConf struct {
+	User       LimitConf `yaml:"user"`
+	Connection LimitConf `yaml:"connection"`
+}
+
+func getRateLimitsPath() string {
+	if path := os.Getenv("EVENTS_RATE_LIMITS_PATH"); path != "" {
+		return path
+	}
+
+	return "config/ratelimits.yaml"
+}
+
+// getRateLimits reads the limits keyed by user type, messages aren't limited when there are none
+func getRateLimits() map[string]RateLimitConf {
+	b, err := os.ReadFile(getRateLimitsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		panic("couldn't read from ratelimits.yaml: " + err.Error())
+	}
+	limits := map[string]RateLimitConf{}
+	err = yaml.Unmarshal(b, &limits)
+	if err != nil {
+		panic("couldn't unmarshal from ratelimits.yaml: " + err.Error())
+	}
+	return limits
+}
+
+var RateLimitsConf = getRateLimits()
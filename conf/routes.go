@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Event Routing Configurations
+*/
+
+// RouteConf sends the events matching its patterns to their own sink, see config/routes.yaml
+type RouteConf struct {
+	Name       string `yaml:"name"`
+	EventType  string `yaml:"event_type"`
+	Source     string `yaml:"source"`
+	ObjectType string `yaml:"object_type"`
+	Sink       string `yaml:"sink"` // defaults to the sink of unrouted events
+	KafkaTopic string `yaml:"kafka_topic"`
+	FilePath   string `yaml:"file_path"`
+}
+
+func getRoutesPath() string {
+	if path := os.Getenv("EVENTS_ROUTES_PATH"); path != "" {
+		return path
+	}
+
+	return "config/routes.yaml"
+}
+
+// getEventRoutes reads the routing table, events go to the default sink when there is none
+func getEventRoutes() []RouteConf {
+	b, err := os.ReadFile(getRoutesPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		panic("couldn't read from routes.yaml: " + err.Error())
+	}
+	routes := []RouteConf{}
+	err = yaml.Unmarshal(b, &routes)
+	if err != nil {
+		panic("couldn't unmarshal from routes.yaml: " + err.Error())
+	}
+	for i := range routes {
+		if routes[i].Sink == "" {
+			routes[i].Sink = getEventSink()
+		}
+	}
+	return routes
+}
+
+var RoutesConf = getEventRoutes()
@@ -0,0 +1,59 @@
+package conf
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+Server Configurations
+*/
+
+// getShutdownTimeout returns how long the server drains clients and events
+// for on SIGTERM, it has to stay below the grace period of the orchestrator
+func getShutdownTimeout() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("EVENTS_SHUTDOWN_TIMEOUT")); err == nil && value > 0 {
+		return value
+	}
+
+	return time.Second * 25
+}
+
+// getMetricsAddr returns the address /metrics is served on, the prometheus
+// port set up by the Dockerfile. Without one it is served next to /event,
+// behind a token of the MetricsUserTypes.
+func getMetricsAddr() string {
+	if port := os.Getenv("PROMETHEUS_PORT"); port != "" {
+		return ":" + port
+	}
+
+	return ""
+}
+
+// getMetricsUserTypes returns the user types whose tokens may read /metrics
+// when it is served next to /event
+func getMetricsUserTypes() []string {
+	if userTypes := os.Getenv("EVENTS_METRICS_USER_TYPES"); userTypes != "" {
+		return strings.Split(userTypes, ",")
+	}
+
+	return []string{"service"}
+}
+
+// getGRPCAddr returns the address the gRPC event service listens on, an
+// empty EVENTS_GRPC_ADDR disables it
+func getGRPCAddr() string {
+	if addr, ok := os.LookupEnv("EVENTS_GRPC_ADDR"); ok {
+		return addr
+	}
+
+	return ":3336"
+}
+
+var ServerConf = map[string]interface{}{
+	"ShutdownTimeout":  getShutdownTimeout(),
+	"MetricsAddr":      getMetricsAddr(),
+	"MetricsUserTypes": getMetricsUserTypes(),
+	"GRPCAddr":         getGRPCAddr(),
+}
@@ -0,0 +1,142 @@
+package conf
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Websocket Configurations
+*/
+
+// getAckMode returns when events are acknowledged to clients that don't ask
+// for a mode: "accepted" once queued for batching, "delivered" once written to the sink
+func getAckMode() string {
+	if mode := os.Getenv("EVENTS_ACK_MODE"); mode != "" {
+		return mode
+	}
+
+	return "accepted"
+}
+
+// getPushUserTypes returns the user types whose tokens may push notifications to clients
+func getPushUserTypes() []string {
+	if userTypes := os.Getenv("EVENTS_PUSH_USER_TYPES"); userTypes != "" {
+		return strings.Split(userTypes, ",")
+	}
+
+	return []string{"service"}
+}
+
+// getPushRelay tells whether pushed notifications are relayed through redis
+// pub/sub to the users connected to the other instances
+func getPushRelay() bool {
+	if relay, err := strconv.ParseBool(os.Getenv("EVENTS_PUSH_RELAY")); err == nil {
+		return relay
+	}
+
+	return true
+}
+
+// getPresence tells whether the connected users are tracked in redis
+func getPresence() bool {
+	if presence, err := strconv.ParseBool(os.Getenv("EVENTS_PRESENCE")); err == nil {
+		return presence
+	}
+
+	return true
+}
+
+// getPresenceUserTypes returns the user types whose tokens may query who is online
+func getPresenceUserTypes() []string {
+	if userTypes := os.Getenv("EVENTS_PRESENCE_USER_TYPES"); userTypes != "" {
+		return strings.Split(userTypes, ",")
+	}
+
+	return []string{"service"}
+}
+
+// getChannelAnyOrgUserTypes returns the user types allowed to subscribe to the
+// channels of every organization, e.g. internal services
+func getChannelAnyOrgUserTypes() []string {
+	if userTypes := os.Getenv("EVENTS_CHANNEL_ANY_ORG_USER_TYPES"); userTypes != "" {
+		return strings.Split(userTypes, ",")
+	}
+
+	return []string{"service"}
+}
+
+// getChannelUserTypes returns the user types allowed to subscribe to the
+// channels of each kind, EVENTS_CHANNEL_USER_TYPES is formatted like
+// "loan=lender,service;org=admin"
+func getChannelUserTypes() map[string][]string {
+	channels := os.Getenv("EVENTS_CHANNEL_USER_TYPES")
+	if channels == "" {
+		return map[string][]string{"loan": {"lender", "service"}}
+	}
+
+	userTypes := map[string][]string{}
+	for _, channel := range strings.Split(channels, ";") {
+		kind, types, ok := strings.Cut(channel, "=")
+		if !ok || kind == "" || types == "" {
+			panic("invalid EVENTS_CHANNEL_USER_TYPES entry: " + channel)
+		}
+		userTypes[kind] = strings.Split(types, ",")
+	}
+	return userTypes
+}
+
+// getPositiveDuration reads a positive duration from the env, falling back to def
+func getPositiveDuration(key string, def time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+
+	return def
+}
+
+// getIdleTimeout returns how long a client may go without sending a frame
+// before it is disconnected, pongs don't count. 0 disables the timeout.
+func getIdleTimeout() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("EVENTS_WS_IDLE_TIMEOUT")); err == nil && value >= 0 {
+		return value
+	}
+
+	return time.Minute * 10
+}
+
+// getThrottleCloseAfter returns how many throttled frames within a minute get a client disconnected
+func getThrottleCloseAfter() int {
+	if value, err := strconv.Atoi(os.Getenv("EVENTS_THROTTLE_CLOSE_AFTER")); err == nil && value > 0 {
+		return value
+	}
+
+	return 20
+}
+
+// getNotificationHistory returns how many notifications are kept per user and
+// channel for SSE clients resuming with Last-Event-ID. 0 disables the history.
+func getNotificationHistory() int {
+	if value, err := strconv.Atoi(os.Getenv("EVENTS_NOTIFICATION_HISTORY")); err == nil && value >= 0 {
+		return value
+	}
+
+	return 100
+}
+
+var WebsocketConf = map[string]interface{}{
+	"AckMode":                getAckMode(),
+	"PushUserTypes":          getPushUserTypes(),
+	"PushRelay":              getPushRelay(),
+	"Presence":               getPresence(),
+	"PresenceUserTypes":      getPresenceUserTypes(),
+	"ChannelUserTypes":       getChannelUserTypes(),
+	"ChannelAnyOrgUserTypes": getChannelAnyOrgUserTypes(),
+	"PingInterval":           getPositiveDuration("EVENTS_WS_PING_INTERVAL", time.Second*30),
+	"PongTimeout":            getPositiveDuration("EVENTS_WS_PONG_TIMEOUT", time.Second*10),
+	"IdleTimeout":            getIdleTimeout(),
+	"ThrottleCloseAfter":     getThrottleCloseAfter(),
+	"NotificationHistory":    getNotificationHistory(),
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+var (
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	// write the public keys to a jwks file
+	dir, err := os.MkdirTemp("", "jwks")
+	if err != nil {
+		panic(err)
+	}
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	doc := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+		},
+	}
+	b, _ := json.Marshal(doc)
+	path := filepath.Join(dir, "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		panic(err)
+	}
+	// init the auth package
+	if err := Init(testSecret, path); err != nil {
+		panic(err)
+	}
+	// run the test cases
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("couldn't sign token: %s", err.Error())
+	}
+	return s
+}
+
+func TestParseToken(t *testing.T) {
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"user_id":   "user1",
+			"user_type": "lender",
+			"org_id":    "org1",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	expired := valid()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	noExpiry := valid()
+	delete(noExpiry, "exp")
+	subjectOnly := valid()
+	delete(subjectOnly, "user_id")
+	subjectOnly["sub"] = "user2"
+	noUser := valid()
+	delete(noUser, "user_id")
+
+	type testStruct struct {
+		token  string
+		user   string
+		expErr error
+	}
+	var testCases = []testStruct{
+		{sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), valid()), "user1", nil},
+		{sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, valid()), "user1", nil},
+		{sign(t, jwt.SigningMethodES256, "ec-1", ecKey, valid()), "user1", nil},
+		{sign(t, jwt.SigningMethodES256, "", ecKey, valid()), "user1", nil},                                    // single ec key, kid not needed
+		{sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), subjectOnly), "user2", nil},                   // falls back to sub
+		{sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), expired), "", ErrorTokenExpired},              // expired
+		{sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), noExpiry), "", ErrorTokenInvalid},             // exp is required
+		{sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), noUser), "", ErrorTokenInvalid},               // no user claim
+		{sign(t, jwt.SigningMethodHS256, "", []byte("other-secret"), valid()), "", ErrorTokenInvalid},          // bad signature
+		{sign(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, valid()), "", ErrorTokenInvalid},                     // unknown kid
+		{sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, valid()), "", ErrorTokenInvalid}, // alg none
+		{"not.a.token", "", ErrorTokenInvalid},
+		{"", "", ErrorTokenMissing},
+	}
+	for index, test := range testCases {
+		claims, err := ParseToken(test.token)
+		if test.expErr != nil {
+			if !errors.Is(err, test.expErr) {
+				t.Errorf("Case %d: Parse Error: (expected: %v, got: %v)", index+1, test.expErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %d: Parse Error: (expected: nil, got: %s)", index+1, err.Error())
+			continue
+		}
+		if claims.UserID != test.user || claims.UserType != "lender" || claims.OrgID != "org1" {
+			t.Errorf("Case %d: Claims Mismatch: (expected: %s, got: %+v)", index+1, test.user, claims)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	var testCases = map[string]string{
+		"Bearer abc":  "abc",
+		"bearer  abc": "abc",
+		"Basic abc":   "",
+		"Bearer":      "",
+		"":            "",
+	}
+	for header, expected := range testCases {
+		if got := BearerToken(header); got != expected {
+			t.Errorf("BearerToken(%q): (expected: %q, got: %q)", header, expected, got)
+		}
+	}
+}
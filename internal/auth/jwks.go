@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// JWKS holds the public keys read from a JSON Web Key Set file, indexed by key id
+type JWKS struct {
+	rsaKeys   map[string]*rsa.PublicKey
+	ecdsaKeys map[string]*ecdsa.PublicKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS reads the RSA and EC keys from a JWKS file, other key types are ignored
+func LoadJWKS(path string) (*JWKS, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: couldn't read jwks file: %w", err)
+	}
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parses the RSA and EC keys from a JWKS document
+func ParseJWKS(b []byte) (*JWKS, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("auth: couldn't unmarshal jwks: %w", err)
+	}
+
+	jwks := &JWKS{
+		rsaKeys:   make(map[string]*rsa.PublicKey),
+		ecdsaKeys: make(map[string]*ecdsa.PublicKey),
+	}
+	for _, key := range doc.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			pub, err := key.rsaPublicKey()
+			if err != nil {
+				return nil, fmt.Errorf("auth: invalid rsa key %q: %w", key.Kid, err)
+			}
+			jwks.rsaKeys[key.Kid] = pub
+		case "EC":
+			pub, err := key.ecdsaPublicKey()
+			if err != nil {
+				return nil, fmt.Errorf("auth: invalid ec key %q: %w", key.Kid, err)
+			}
+			jwks.ecdsaKeys[key.Kid] = pub
+		}
+	}
+	if len(jwks.rsaKeys) == 0 && len(jwks.ecdsaKeys) == 0 {
+		return nil, errors.New("auth: jwks has no usable signing keys")
+	}
+	return jwks, nil
+}
+
+// rsaKey returns the key for kid, a token without kid is accepted only if the set has a single key
+func (j *JWKS) rsaKey(kid string) (*rsa.PublicKey, error) {
+	if j == nil {
+		return nil, ErrorNotConfigured
+	}
+	if key, ok := j.rsaKeys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(j.rsaKeys) == 1 {
+		for _, key := range j.rsaKeys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown rsa key id %q", kid)
+}
+
+// ecdsaKey returns the key for kid, a token without kid is accepted only if the set has a single key
+func (j *JWKS) ecdsaKey(kid string) (*ecdsa.PublicKey, error) {
+	if j == nil {
+		return nil, ErrorNotConfigured
+	}
+	if key, ok := j.ecdsaKeys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(j.ecdsaKeys) == 1 {
+		for _, key := range j.ecdsaKeys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown ec key id %q", kid)
+}
+
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() < 3 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, errors.New("point is not on curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
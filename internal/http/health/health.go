@@ -0,0 +1,99 @@
+// Package health serves the liveness and readiness probes of the service
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Statuses reported by Readyz
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// checkTimeout bounds every check, a dependency slower than that counts as down
+const checkTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// CheckResult is the report of a single check
+type CheckResult struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// Report is the body of Readyz
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+var checks = struct {
+	sync.RWMutex
+	m map[string]Check
+}{m: make(map[string]Check)}
+
+// Register adds a check run by Readyz under the given name
+func Register(name string, check Check) {
+	checks.Lock()
+	defer checks.Unlock()
+	checks.m[name] = check
+}
+
+// Healthz tells that the process is alive, it doesn't look at dependencies
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": StatusOK})
+}
+
+// Readyz runs every registered check at once and responds 503 when any fails
+func Readyz(c *fiber.Ctx) error {
+	report := Run(c.Context())
+	if report.Status != StatusOK {
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(report)
+}
+
+// Run runs every registered check concurrently
+func Run(ctx context.Context) Report {
+	checks.RLock()
+	defer checks.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks.m))}
+	for name, check := range checks.m {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusUnavailable
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+func runCheck(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check(ctx)
+	result := CheckResult{Status: StatusOK, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
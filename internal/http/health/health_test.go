@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReadyz(t *testing.T) {
+	type testStruct struct {
+		checks    map[string]Check
+		expCode   int
+		expStatus string
+	}
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	var testCases = []testStruct{
+		{map[string]Check{}, fiber.StatusOK, StatusOK},
+		{map[string]Check{"redis_primary": ok, "kafka": ok}, fiber.StatusOK, StatusOK},
+		{map[string]Check{"redis_primary": ok, "kafka": down}, fiber.StatusServiceUnavailable, StatusUnavailable},
+		{map[string]Check{"redis_replica": slow}, fiber.StatusServiceUnavailable, StatusUnavailable},
+	}
+	registered := checks.m
+	t.Cleanup(func() { checks.m = registered })
+	for index, test := range testCases {
+		checks.m = make(map[string]Check)
+		for name, check := range test.checks {
+			Register(name, check)
+		}
+		app := fiber.New()
+		app.Get("/readyz", Readyz)
+		resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil), -1)
+		if err != nil {
+			t.Fatalf("Case %d: request Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		var report Report
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("Case %d: decode Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if resp.StatusCode != test.expCode {
+			t.Errorf("Case %d: status code Error: (expected: %d, got: %d)", index+1, test.expCode, resp.StatusCode)
+		}
+		if report.Status != test.expStatus {
+			t.Errorf("Case %d: status Error: (expected: %s, got: %s)", index+1, test.expStatus, report.Status)
+		}
+		if len(report.Checks) != len(test.checks) {
+			t.Errorf("Case %d: checks Error: (expected: %d, got: %d)", index+1, len(test.checks), len(report.Checks))
+		}
+	}
+}
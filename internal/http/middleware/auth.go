@@ -0,0 +1,48 @@
+// Package middleware holds the fiber middlewares shared by the http endpoints
+package middleware
+
+import (
+	"errors"
+	"go-event-management/internal/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireToken verifies the bearer token of the request and sets its claims to
+// the "claims" local. With userTypes given, only tokens of those user types are
+// let through. It responds 401 to a missing or rejected token and 403 to a
+// user type that isn't allowed.
+func RequireToken(userTypes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := auth.ParseToken(auth.BearerToken(c.Get(fiber.HeaderAuthorization)))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": TokenError(err)})
+		}
+		if len(userTypes) > 0 && !contains(userTypes, claims.UserType) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user type " + claims.UserType + " is not allowed"})
+		}
+		c.Locals("claims", claims)
+		c.Locals("user", claims.UserID)
+		return c.Next()
+	}
+}
+
+// TokenError hides the verification details of a rejected token from the client
+func TokenError(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrorTokenMissing):
+		return "token is missing"
+	case errors.Is(err, auth.ErrorTokenExpired):
+		return "token is expired"
+	}
+	return "token is invalid"
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"go-event-management/internal/auth"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const secret = "middleware-test-secret"
+
+func signToken(t *testing.T, userType string, expiresIn time.Duration) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":   "user-1",
+		"user_type": userType,
+		"exp":       time.Now().Add(expiresIn).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequireToken(t *testing.T) {
+	if err := auth.Init(secret, ""); err != nil {
+		t.Fatal(err)
+	}
+	type testStruct struct {
+		header    string
+		userTypes []string
+		expCode   int
+	}
+	var testCases = []testStruct{
+		{"", nil, fiber.StatusUnauthorized},
+		{"Bearer not-a-token", nil, fiber.StatusUnauthorized},
+		{"Bearer " + signToken(t, "lender", -time.Minute), nil, fiber.StatusUnauthorized},
+		{"Bearer " + signToken(t, "lender", time.Minute), nil, fiber.StatusOK},
+		{"Bearer " + signToken(t, "lender", time.Minute), []string{"service"}, fiber.StatusForbidden},
+		{"Bearer " + signToken(t, "service", time.Minute), []string{"service"}, fiber.StatusOK},
+	}
+	for index, test := range testCases {
+		app := fiber.New()
+		app.Get("/", RequireToken(test.userTypes...), func(c *fiber.Ctx) error {
+			return c.SendString(c.Locals("user").(string))
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			req.Header.Set(fiber.HeaderAuthorization, test.header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Case %d: request Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if resp.StatusCode != test.expCode {
+			t.Errorf("Case %d: status code Error: (expected: %d, got: %d)", index+1, test.expCode, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"go-event-management/internal/auth"
+	"log"
+	"strings"
+)
+
+// Frame types clients subscribe to and unsubscribe from channels with
+const (
+	FrameSubscribe   = "subscribe"
+	FrameUnsubscribe = "unsubscribe"
+)
+
+// maxChannelLength bounds the channel names clients send
+const maxChannelLength = 200
+
+var (
+	ErrorInvalidChannel   = errors.New("websocket: channel must be <kind>:<org_id>:<id> of a known kind")
+	ErrorChannelForbidden = errors.New("websocket: not allowed to subscribe to the channel")
+)
+
+// authorizeChannel checks that the token may subscribe to the channel. A
+// channel is named <kind>:<org_id>:<id>, e.g. loan:<organization_id>:<loan_application_id>,
+// so that the updates of an organization only reach its own tokens. The user
+// types of ChannelAnyOrgUserTypes subscribe to the channels of any organization.
+func authorizeChannel(claims *auth.Claims, channel string) error {
+	kind, rest, _ := strings.Cut(channel, ":")
+	org, id, _ := strings.Cut(rest, ":")
+	if kind == "" || org == "" || id == "" || len(channel) > maxChannelLength {
+		return ErrorInvalidChannel
+	}
+	userTypes, ok := config.ChannelUserTypes[kind]
+	if !ok {
+		return ErrorInvalidChannel
+	}
+	if !contains(userTypes, claims.UserType) {
+		return ErrorChannelForbidden
+	}
+	if org != claims.OrgID && !contains(config.ChannelAnyOrgUserTypes, claims.UserType) {
+		return ErrorChannelForbidden
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSubscription processes a subscribe or unsubscribe frame, the frame
+// is acked once the hub updated the subscriptions
+func (c ClientObject) handleSubscription(frame RequestFrame) {
+	if frame.ID == "" {
+		c.nack("", NackInvalidFrame, errors.New("frame id is required"))
+		return
+	}
+	hub := unsubscribe
+	if frame.Type == FrameSubscribe {
+		if err := authorizeChannel(c.claims, frame.Channel); err != nil {
+			code := NackInvalidChannel
+			if errors.Is(err, ErrorChannelForbidden) {
+				code = NackForbidden
+			}
+			c.nack(frame.ID, code, err)
+			return
+		}
+		hub = subscribe
+	}
+
+	sub := subscription{client: c, channel: frame.Channel, result: make(chan error, 1)}
+	hub <- sub
+	if err := <-sub.result; err != nil {
+		code := NackInternal
+		if errors.Is(err, ErrorSubscriptionLimit) {
+			code = NackSubscriptionLimit
+		}
+		c.nack(frame.ID, code, err)
+		return
+	}
+	c.ack(frame.ID)
+}
+
+// subscribeClient is called by SocketHandler, the first subscriber of a
+// channel on this instance subscribes to its relay
+func subscribeClient(client ClientObject, channel string) error {
+	first, err := clients.subscribe(client.id, channel)
+	if err != nil {
+		return err
+	}
+	if first {
+		subscribeChannel(channel)
+	}
+	log.Println("client subscribed:", client.user, client.id, channel)
+	return nil
+}
+
+// unsubscribeClient is called by SocketHandler, the last subscriber of a
+// channel on this instance unsubscribes from its relay
+func unsubscribeClient(client ClientObject, channel string) {
+	if clients.unsubscribe(client.id, channel) {
+		unsubscribeChannel(channel)
+	}
+}
+
+// Broadcast writes the notification to every connection subscribed to the
+// channel on this instance, and relays it through redis to the subscribers
+// of the other instances when StartRelay was called
+func Broadcast(channel string, notification json.RawMessage) (PushResult, error) {
+	frame, err := newNotificationFrame(channel, notification)
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	result := deliverChannel(channel, frame)
+	recordHistory(channelFeed(channel), frame)
+	if relay != nil {
+		envelope := relayEnvelope{Origin: instanceID, Channel: channel, Frame: frame}
+		remote, err := publishNotification(envelope, len(result.Connections) > 0)
+		if err != nil {
+			log.Println("notification relay error:", err)
+			result.RelayError = err.Error()
+		}
+		result.RemoteInstances = remote
+	}
+	return result, nil
+}
@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-event-management/pkg/events/eventspb"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Frame encodings, a client picks one at connect time with a subprotocol or
+// the encoding query param. JSON frames are text frames, MessagePack and
+// Protobuf frames are binary frames.
+const (
+	EncodingJSON     = "json"
+	EncodingMsgpack  = "msgpack"
+	EncodingProtobuf = "protobuf"
+)
+
+const subprotocolPrefix = "events.v1."
+
+// Subprotocols are the websocket subprotocols selecting an encoding. When a
+// client offers several, the first one of this list it offers is picked.
+var Subprotocols = []string{
+	subprotocolPrefix + EncodingProtobuf,
+	subprotocolPrefix + EncodingMsgpack,
+	subprotocolPrefix + EncodingJSON,
+}
+
+var (
+	ErrorUnsupportedFrame = errors.New("websocket: unsupported frame")
+	ErrorUnknownEncoding  = errors.New("websocket: encoding must be json, msgpack or protobuf")
+)
+
+var (
+	frameJSON  = protojson.MarshalOptions{UseProtoNames: true}
+	frameProto = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// codec converts the frames of an encoding from and to the JSON frames of the
+// protocol, so that binary frames are handled like text frames once decoded
+type codec interface {
+	messageType() int
+	// decode returns the JSON frame of a message read from the client
+	decode(messageType int, message []byte) ([]byte, error)
+	// encode returns the message to write for a JSON frame
+	encode(frame []byte) ([]byte, error)
+}
+
+// newCodec returns the codec of an encoding, JSON for an empty one
+func newCodec(encoding string) (codec, error) {
+	switch encoding {
+	case "", EncodingJSON:
+		return jsonCodec{}, nil
+	case EncodingMsgpack:
+		return msgpackCodec{}, nil
+	case EncodingProtobuf:
+		return protobufCodec{}, nil
+	}
+	return nil, ErrorUnknownEncoding
+}
+
+// subprotocolEncoding returns the encoding selected by a negotiated subprotocol
+func subprotocolEncoding(subprotocol string) string {
+	for _, s := range Subprotocols {
+		if s == subprotocol {
+			return subprotocol[len(subprotocolPrefix):]
+		}
+	}
+	return ""
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) messageType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) decode(messageType int, message []byte) ([]byte, error) {
+	if messageType != websocket.TextMessage {
+		return nil, fmt.Errorf("%w: only text frames are supported with the json encoding", ErrorUnsupportedFrame)
+	}
+	return message, nil
+}
+
+func (jsonCodec) encode(frame []byte) ([]byte, error) {
+	return frame, nil
+}
+
+// msgpackCodec maps MessagePack maps, arrays and values one to one to JSON
+type msgpackCodec struct{}
+
+func (msgpackCodec) messageType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) decode(messageType int, message []byte) ([]byte, error) {
+	if messageType != websocket.BinaryMessage {
+		return nil, fmt.Errorf("%w: only binary frames are supported with the msgpack encoding", ErrorUnsupportedFrame)
+	}
+	var frame interface{}
+	if err := msgpack.Unmarshal(message, &frame); err != nil {
+		return nil, err
+	}
+	return json.Marshal(frame)
+}
+
+func (msgpackCodec) encode(frame []byte) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(frame, &value); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	// JSON numbers are decoded as floats, whole ones are written as ints
+	encoder.UseCompactInts(true)
+	encoder.UseCompactFloats(true)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// protobufCodec reads eventspb.ClientFrame messages and writes eventspb.ServerFrame messages
+type protobufCodec struct{}
+
+func (protobufCodec) messageType() int {
+	return websocket.BinaryMessage
+}
+
+func (protobufCodec) decode(messageType int, message []byte) ([]byte, error) {
+	if messageType != websocket.BinaryMessage {
+		return nil, fmt.Errorf("%w: only binary frames are supported with the protobuf encoding", ErrorUnsupportedFrame)
+	}
+	var frame eventspb.ClientFrame
+	if err := proto.Unmarshal(message, &frame); err != nil {
+		return nil, err
+	}
+	return frameJSON.Marshal(&frame)
+}
+
+func (protobufCodec) encode(frame []byte) ([]byte, error) {
+	var message eventspb.ServerFrame
+	if err := frameProto.Unmarshal(frame, &message); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&message)
+}
@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"go-event-management/pkg/events/eventspb"
+	"testing"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodecDecode(t *testing.T) {
+	msgpackFrame, _ := msgpack.Marshal(map[string]interface{}{
+		"id":    "f1",
+		"type":  FrameEvent,
+		"event": map[string]interface{}{"event_type": "click", "loan_meta_data": map[string]interface{}{"program": "p1"}},
+	})
+	protobufFrame, _ := proto.Marshal(&eventspb.ClientFrame{
+		Id:    "f1",
+		Type:  FrameEvent,
+		Event: &eventspb.EventMessage{EventType: "click", LoanMetaData: &eventspb.LoanMetaData{Program: "p1"}},
+	})
+	jsonFrame := []byte(`{"id":"f1","type":"event","event":{"event_type":"click","loan_meta_data":{"program":"p1"}}}`)
+
+	type testStruct struct {
+		encoding    string
+		messageType int
+		message     []byte
+		expErr      error // only checked with errors.Is when set, decode errors are checked with expInvalid
+		expInvalid  bool
+	}
+	var testCases = []testStruct{
+		{EncodingJSON, websocket.TextMessage, jsonFrame, nil, false},
+		{EncodingJSON, websocket.BinaryMessage, jsonFrame, ErrorUnsupportedFrame, false},
+		{EncodingMsgpack, websocket.BinaryMessage, msgpackFrame, nil, false},
+		{EncodingMsgpack, websocket.TextMessage, jsonFrame, ErrorUnsupportedFrame, false},
+		{EncodingMsgpack, websocket.BinaryMessage, []byte{0xc1}, nil, true},
+		{EncodingProtobuf, websocket.BinaryMessage, protobufFrame, nil, false},
+		{EncodingProtobuf, websocket.BinaryMessage, []byte{0xff, 0xff}, nil, true},
+	}
+
+	for i, testCase := range testCases {
+		frameCodec, err := newCodec(testCase.encoding)
+		if err != nil {
+			t.Errorf("Case %d: Codec Error: %v", i, err)
+			continue
+		}
+		decoded, err := frameCodec.decode(testCase.messageType, testCase.message)
+		if testCase.expErr != nil || testCase.expInvalid {
+			if err == nil || (testCase.expErr != nil && !errors.Is(err, testCase.expErr)) {
+				t.Errorf("Case %d: Decode Error: (expected: %v, got: %v)", i, testCase.expErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %d: Decode Error: %v", i, err)
+			continue
+		}
+		var frame RequestFrame
+		var event struct {
+			EventType    string `json:"event_type"`
+			LoanMetaData struct {
+				Program string `json:"program"`
+			} `json:"loan_meta_data"`
+		}
+		if err := json.Unmarshal(decoded, &frame); err != nil {
+			t.Errorf("Case %d: Frame Error: %v", i, err)
+			continue
+		}
+		json.Unmarshal(frame.Event, &event)
+		if frame.ID != "f1" || frame.Type != FrameEvent || event.EventType != "click" || event.LoanMetaData.Program != "p1" {
+			t.Errorf("Case %d: Frame Error: (expected: f1 event click p1, got: %s %s %s %s)", i, frame.ID, frame.Type, event.EventType, event.LoanMetaData.Program)
+		}
+	}
+
+	if _, err := newCodec("xml"); !errors.Is(err, ErrorUnknownEncoding) {
+		t.Errorf("Unknown Encoding Error: (expected: %v, got: %v)", ErrorUnknownEncoding, err)
+	}
+}
+
+func TestCodecEncode(t *testing.T) {
+	nack, _ := json.Marshal(ResponseFrame{Type: FrameNack, ID: "f1", Code: NackThrottled, RetryAfterMs: 250})
+	notification, _ := json.Marshal(NotificationFrame{Type: FrameNotification, ID: "n1", Channel: "loan:1", Notification: json.RawMessage(`{"count":3}`)})
+
+	message, err := msgpackCodec{}.encode(nack)
+	var msgpackNack map[string]interface{}
+	if err == nil {
+		err = msgpack.Unmarshal(message, &msgpackNack)
+	}
+	// whole numbers are written as ints, the smallest one 250 fits in is a uint8
+	if err != nil || msgpackNack["code"] != NackThrottled || msgpackNack["retry_after_ms"] != uint8(250) {
+		t.Errorf("Msgpack Nack Error: (expected: throttled 250, got: %v %v)", msgpackNack, err)
+	}
+
+	message, err = protobufCodec{}.encode(notification)
+	var frame eventspb.ServerFrame
+	if err == nil {
+		err = proto.Unmarshal(message, &frame)
+	}
+	if err != nil || frame.GetId() != "n1" || frame.GetChannel() != "loan:1" || frame.GetNotification().GetStructValue().GetFields()["count"].GetNumberValue() != 3 {
+		t.Errorf("Protobuf Notification Error: (expected: n1 loan:1 count 3, got: %v %v)", &frame, err)
+	}
+}
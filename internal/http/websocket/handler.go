@@ -1,9 +1,10 @@
 package websocket
 
 import (
-	"fmt"
-	"go-event-management/pkg/events"
+	"go-event-management/internal/metrics"
 	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func SocketHandler() {
@@ -11,16 +12,31 @@ func SocketHandler() {
 		select {
 		case client := <-register:
 
-			clients[client.user] = client.conn
-			log.Println("client registered:", client.user)
-
-		case message := <-broadcast:
-			fmt.Println(message.msg)
-			events.TrigerEvent(message.EventMessage)
+			if clients.add(client) {
+				subscribeUser(client.user)
+			}
+			client.connectionGauge().Inc()
+			connectPresence(client)
+			log.Println("client registered:", client.user, client.id)
 
 		case client := <-unregister:
-			removeClient(client.user) // Update client removal
-			log.Println("client unregistered:", client.user)
+			removeClient(client)
+			log.Println("client unregistered:", client.user, client.id)
+
+		case sub := <-subscribe:
+			sub.result <- subscribeClient(sub.client, sub.channel)
+
+		case sub := <-unsubscribe:
+			unsubscribeClient(sub.client, sub.channel)
+			sub.result <- nil
 		}
 	}
 }
+
+// connectionGauge returns the gauge the client is counted in, by its transport
+func (c ClientObject) connectionGauge() prometheus.Gauge {
+	if c.stream != nil {
+		return metrics.SSEStreams
+	}
+	return metrics.WebsocketConnections
+}
@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"errors"
+	"go-event-management/internal/metrics"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+// Reasons a connection is reaped for
+const (
+	reapedPongTimeout = "pong_timeout" // the client stopped answering pings, e.g. a half-open connection
+	reapedIdle        = "idle"         // the client sent nothing for IdleTimeout
+	reapedRateLimited = "rate_limited" // the client kept sending while throttled
+)
+
+// heartbeat pings a connection every PingInterval and keeps its read deadline
+// a ping round trip ahead, so that a read from a client that went away times
+// out. Data frames and pongs push the deadline further, only data frames
+// count as activity for IdleTimeout.
+type heartbeat struct {
+	conn     *websocket.Conn
+	lastRead atomic.Int64 // unix nanos of the last data frame
+	done     chan struct{}
+	stopped  chan struct{} // closed once run returns
+}
+
+func newHeartbeat(conn *websocket.Conn) *heartbeat {
+	h := &heartbeat{conn: conn, done: make(chan struct{}), stopped: make(chan struct{})}
+	h.lastRead.Store(time.Now().UnixNano())
+	h.extend()
+	conn.SetPongHandler(func(string) error {
+		return h.extend()
+	})
+	go h.run()
+	return h
+}
+
+// received records a data frame from the client
+func (h *heartbeat) received() {
+	h.lastRead.Store(time.Now().UnixNano())
+	if err := h.extend(); err != nil {
+		log.Println("read deadline error:", err)
+	}
+}
+
+func (h *heartbeat) extend() error {
+	return h.conn.SetReadDeadline(time.Now().Add(config.PingInterval + config.PongTimeout))
+}
+
+// stop waits for run to return, the connection is released to the pool of
+// the websocket package once the handler returns and can't be used afterwards
+func (h *heartbeat) stop() {
+	close(h.done)
+	<-h.stopped
+}
+
+func (h *heartbeat) run() {
+	defer close(h.stopped)
+	ticker := time.NewTicker(config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			idle := time.Since(time.Unix(0, h.lastRead.Load()))
+			if config.IdleTimeout > 0 && idle >= config.IdleTimeout {
+				h.reapIdle()
+				return
+			}
+			// WriteControl is safe to call next to the writes of writeFrame
+			if err := h.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				log.Println("ping write error:", err)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// reapIdle closes the connection with CloseIdleTimeout, the read loop then
+// fails and unregisters the client
+func (h *heartbeat) reapIdle() {
+	metrics.WebsocketReaped.WithLabelValues(reapedIdle).Inc()
+	message := websocket.FormatCloseMessage(CloseIdleTimeout, "idle timeout")
+	if err := h.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeWriteTimeout)); err != nil {
+		log.Println("close write error:", err)
+	}
+	h.conn.Close()
+}
+
+// isTimeout reports whether a read failed on the read deadline
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// serveHeartbeat serves connections with a heartbeat, like the read loop of
+// EventCont, and reports how each connection ended: reapedPongTimeout when
+// the read deadline passed, "closed" for any other read error
+func serveHeartbeat(t *testing.T) (string, <-chan string) {
+	ended := make(chan string, 1)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", websocket.New(func(c *websocket.Conn) {
+		heartbeat := newHeartbeat(c)
+		defer heartbeat.stop()
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				if isTimeout(err) {
+					ended <- reapedPongTimeout
+				} else {
+					ended <- "closed"
+				}
+				return
+			}
+			heartbeat.received()
+		}
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(lis)
+	t.Cleanup(func() { app.Shutdown() })
+	return lis.Addr().String(), ended
+}
+
+func TestHeartbeat(t *testing.T) {
+	defer func(cfg Config) { config = cfg }(config)
+	config.PingInterval, config.PongTimeout = 20*time.Millisecond, 30*time.Millisecond
+	addr, ended := serveHeartbeat(t)
+
+	type testStruct struct {
+		pongs        bool          // whether the client answers pings
+		sendEvery    time.Duration // how often the client sends a data frame, 0 never
+		idleTimeout  time.Duration
+		expEnded     string // how the server side ended, "" while still open
+		expCloseCode int    // close code the client got, 0 for none
+	}
+	var testCases = []testStruct{
+		{true, 0, 0, "", 0},
+		{true, 10 * time.Millisecond, 60 * time.Millisecond, "", 0},
+		// pongs keep the connection open, they don't count as activity
+		{true, 0, 60 * time.Millisecond, "closed", CloseIdleTimeout},
+		{false, 0, 0, reapedPongTimeout, 0},
+		// data frames push the read deadline like pongs do
+		{false, 10 * time.Millisecond, 0, "", 0},
+	}
+	for index, test := range testCases {
+		config.IdleTimeout = test.idleTimeout
+		conn, _, err := fastws.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+		if err != nil {
+			t.Fatalf("Case %d: dial Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if !test.pongs {
+			conn.SetPingHandler(func(string) error { return nil })
+		}
+		// pings are answered from the read loop of the client
+		closed := make(chan error, 1)
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					closed <- err
+					return
+				}
+			}
+		}()
+		stop := make(chan struct{})
+		if test.sendEvery > 0 {
+			go func() {
+				ticker := time.NewTicker(test.sendEvery)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						conn.WriteMessage(fastws.TextMessage, []byte(`{"event_type":"click"}`))
+					case <-stop:
+						return
+					}
+				}
+			}()
+		}
+
+		got := ""
+		select {
+		case got = <-ended:
+		case <-time.After(300 * time.Millisecond):
+		}
+		close(stop)
+		if got != test.expEnded {
+			t.Errorf("Case %d: connection end Error: (expected: %q, got: %q)", index+1, test.expEnded, got)
+		}
+		if test.expCloseCode != 0 {
+			var closeErr *fastws.CloseError
+			if err := <-closed; !errors.As(err, &closeErr) || closeErr.Code != test.expCloseCode {
+				t.Errorf("Case %d: close code Error: (expected: %d, got: %v)", index+1, test.expCloseCode, err)
+			}
+		}
+		conn.Close()
+		if got == "" {
+			<-ended // the server side of an open connection fails once the client closes it
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"go-event-management/internal/repository/redis"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyTTL bounds how long after the last notification of a feed its history is kept
+const historyTTL = time.Hour
+
+// allFeed is the feed of the notifications pushed to every connection
+const allFeed = "all"
+
+// historyEntry is a notification kept in the history of a feed
+type historyEntry struct {
+	At    int64             `json:"at"` // unix nanos the notification was pushed at
+	Frame NotificationFrame `json:"frame"`
+}
+
+func userFeed(user string) string {
+	return "user:" + user
+}
+
+func channelFeed(channel string) string {
+	return "channel:" + channel
+}
+
+func historyKey(feed string) string {
+	return "notifications:history:" + feed
+}
+
+// historyQueueSize bounds the history writes waiting for redis, frames pushed
+// while it is full are left out of the history
+const historyQueueSize = 1024
+
+// historyWrites are written to redis one at a time by writeHistories, off the
+// path of the live frames
+var (
+	historyWrites = make(chan historyWrite, historyQueueSize)
+	historyWorker sync.Once
+)
+
+type historyWrite struct {
+	feed  string
+	entry historyEntry
+}
+
+// recordHistory queues the frame for the history of the feed, the history holds
+// the last NotificationHistory frames so that SSE clients resume after a
+// reconnect. It never blocks, a slow or unavailable redis only costs history.
+func recordHistory(feed string, frame NotificationFrame) {
+	if config.NotificationHistory <= 0 {
+		return
+	}
+	historyWorker.Do(func() { go writeHistories(historyWrites) })
+	select {
+	case historyWrites <- historyWrite{feed: feed, entry: historyEntry{At: time.Now().UnixNano(), Frame: frame}}:
+	default:
+		log.Println("notification history queue full, frame left out:", frame.ID)
+	}
+}
+
+func writeHistories(writes <-chan historyWrite) {
+	for write := range writes {
+		writeHistory(write.feed, write.entry)
+	}
+}
+
+// writeHistory keeps the entry in the history of the feed
+func writeHistory(feed string, entry historyEntry) {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("notification history marshal error:", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+	defer cancel()
+	if err := redis.LPushCapped(ctx, historyKey(feed), string(value), int64(config.NotificationHistory), historyTTL); err != nil {
+		log.Println("notification history error:", err)
+	}
+}
+
+// replayHistory returns the frames of the feeds pushed after the one with
+// lastEventID, oldest first. Every frame kept is returned when lastEventID is
+// no longer in the history, clients drop the ones they already have by id.
+func replayHistory(ctx context.Context, feeds []string, lastEventID string) ([]NotificationFrame, error) {
+	var entries []historyEntry
+	since := int64(-1)
+	for _, feed := range feeds {
+		values, err := redis.LRange(ctx, historyKey(feed), 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			var entry historyEntry
+			if err := json.Unmarshal([]byte(value), &entry); err != nil {
+				continue
+			}
+			if entry.Frame.ID == lastEventID {
+				since = entry.At
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].At < entries[j].At
+	})
+
+	var frames []NotificationFrame
+	for _, entry := range entries {
+		if entry.At > since && entry.Frame.ID != lastEventID {
+			frames = append(frames, entry.Frame)
+		}
+	}
+	return frames, nil
+}
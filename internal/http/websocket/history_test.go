@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"go-event-management/internal/repository/redis"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMain(m *testing.M) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	redis.Init(false, mr.Addr(), mr.Addr())
+	code := m.Run()
+	mr.Close()
+	os.Exit(code)
+}
+
+func TestReplayHistory(t *testing.T) {
+	config.NotificationHistory = 3
+	defer func() { config.NotificationHistory = 0 }()
+
+	record := func(feed string, id string) {
+		writeHistory(feed, historyEntry{At: time.Now().UnixNano(), Frame: NotificationFrame{ID: id}})
+	}
+	// n1 falls out of the user feed once n5 is recorded
+	record(userFeed("u1"), "n1")
+	record(userFeed("u1"), "n2")
+	record(channelFeed("loan:1"), "n3")
+	record(allFeed, "n4")
+	record(userFeed("u1"), "n5")
+	record(userFeed("u1"), "n6")
+	record(userFeed("u2"), "n7")
+
+	type testStruct struct {
+		feeds       []string
+		lastEventID string
+		expected    string
+	}
+	var testCases = []testStruct{
+		{[]string{userFeed("u1"), allFeed, channelFeed("loan:1")}, "n3", "n4,n5,n6"},
+		{[]string{userFeed("u1"), allFeed, channelFeed("loan:1")}, "n2", "n3,n4,n5,n6"},
+		{[]string{userFeed("u1"), allFeed}, "n2", "n4,n5,n6"},
+		{[]string{userFeed("u1"), allFeed}, "n1", "n2,n4,n5,n6"},
+		{[]string{userFeed("u1"), allFeed}, "n6", ""},
+		{[]string{userFeed("u3")}, "n1", ""},
+	}
+
+	for i, testCase := range testCases {
+		frames, err := replayHistory(context.Background(), testCase.feeds, testCase.lastEventID)
+		if err != nil {
+			t.Errorf("Case %d: Replay Error: %v", i, err)
+			continue
+		}
+		var ids []string
+		for _, frame := range frames {
+			ids = append(ids, frame.ID)
+		}
+		if got := strings.Join(ids, ","); got != testCase.expected {
+			t.Errorf("Case %d: Frames Error: (expected: %s, got: %s)", i, testCase.expected, got)
+		}
+	}
+}
+
+func TestRecordHistory(t *testing.T) {
+	config.NotificationHistory = 3
+	defer func() { config.NotificationHistory = 0 }()
+
+	// frames are written to the history off the caller
+	recordHistory(userFeed("u4"), NotificationFrame{ID: "n1"})
+	recordHistory(userFeed("u4"), NotificationFrame{ID: "n2"})
+	deadline := time.Now().Add(time.Second)
+	var ids []string
+	for time.Now().Before(deadline) {
+		frames, _ := replayHistory(context.Background(), []string{userFeed("u4")}, "")
+		ids = ids[:0]
+		for _, frame := range frames {
+			ids = append(ids, frame.ID)
+		}
+		if len(ids) == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := strings.Join(ids, ","); got != "n1,n2" {
+		t.Errorf("history Error: (expected: n1,n2, got: %s)", got)
+	}
+
+	// a stuck history, e.g. redis down, doesn't hold up the caller
+	defer func(writes chan historyWrite) { historyWrites = writes }(historyWrites)
+	historyWrites = make(chan historyWrite)
+	done := make(chan struct{})
+	go func() {
+		recordHistory(userFeed("u4"), NotificationFrame{ID: "n3"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("recordHistory Error: (expected: to return, got: blocked)")
+	}
+}
@@ -1,25 +1,86 @@
 package websocket
 
 import (
-	"go-event-management/pkg/events"
+	"go-event-management/internal/auth"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/contrib/websocket"
 )
 
-type miniClient map[string]*websocket.Conn // Modified type
-
 type ClientObject struct {
-	user string
-	conn *websocket.Conn
+	id          string // unique per connection
+	user        string
+	claims      *auth.Claims
+	ackMode     string
+	codec       codec // encoding of the frames, see newCodec
+	connectedAt time.Time
+	conn        *websocket.Conn
+	stream      *sseStream // set instead of conn for the clients of SSEHandler
+	writeMu     *sync.Mutex
+}
+
+// Config holds the websocket settings, see Init
+type Config struct {
+	AckMode string // ack mode used when the client doesn't ask for one
+	// ChannelUserTypes lists the user types allowed to subscribe to the channels
+	// of a kind, keyed by kind: the part of the channel name before the colon
+	ChannelUserTypes map[string][]string
+	// ChannelAnyOrgUserTypes lists the user types subscribing to the channels of
+	// any organization, the others only subscribe to the channels of their own
+	ChannelAnyOrgUserTypes []string
+
+	PingInterval time.Duration // how often the server pings every client
+	PongTimeout  time.Duration // how long a ping may go unanswered before the connection is reaped
+	IdleTimeout  time.Duration // how long a client may go without sending a frame, 0 disables it
+
+	ThrottleCloseAfter int // throttled frames within throttleWindow that get a client disconnected
+
+	NotificationHistory int // notifications kept per user, channel and for all, for SSE resume; 0 disables it
+}
+
+// subscription is a subscribe or unsubscribe request handed to SocketHandler,
+// the outcome is sent back on result
+type subscription struct {
+	client  ClientObject
+	channel string
+	result  chan error
 }
 
-type BroadcastObject struct {
-	EventMessage events.EventMessage
-	msg          string
-	from         ClientObject
+// Close codes sent to clients whose token is rejected at upgrade time, and to
+// clients disconnected for sending nothing for IdleTimeout
+const (
+	CloseTokenExpired = 4001
+	CloseTokenInvalid = websocket.ClosePolicyViolation
+	CloseIdleTimeout  = 4002
+	CloseRateLimited  = 4003
+)
+
+// Defaults of the heartbeat settings left unset in Config
+const (
+	defaultPingInterval       = 30 * time.Second
+	defaultPongTimeout        = 10 * time.Second
+	defaultThrottleCloseAfter = 20
+)
+
+const (
+	closeWriteTimeout = time.Second
+	shutdownPoll      = 50 * time.Millisecond // how often Shutdown checks whether the clients are gone
+)
+
+var config = Config{
+	AckMode:            AckAccepted,
+	PingInterval:       defaultPingInterval,
+	PongTimeout:        defaultPongTimeout,
+	ThrottleCloseAfter: defaultThrottleCloseAfter,
 }
 
-var clients = make(miniClient) // Initialized as a nested map
+var clients = newConnectionRegistry()
 var register = make(chan ClientObject)
-var broadcast = make(chan BroadcastObject)
 var unregister = make(chan ClientObject)
+var subscribe = make(chan subscription)
+var unsubscribe = make(chan subscription)
+var draining atomic.Bool // set by Shutdown, upgrades are refused from then on
+var shutdownOnce sync.Once
+var shutdownErr error // returned by every call of Shutdown
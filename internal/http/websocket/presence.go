@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"context"
+	"go-event-management/internal/presence"
+	"log"
+	"time"
+)
+
+// trackPresence is set by StartPresence, connections are recorded in redis from then on
+var trackPresence bool
+
+// stopPresence ends the heartbeats, it is closed by Shutdown
+var stopPresence = make(chan struct{})
+
+// presenceTasks records the connections and disconnections of the hub in order, off the hub goroutine
+var presenceTasks = newTaskQueue()
+
+// StartPresence records the connections of this instance in redis and keeps
+// them alive with heartbeats, it needs to be called before serving connections
+func StartPresence() {
+	trackPresence = true
+	go presenceHeartbeats()
+	go presenceTasks.run()
+}
+
+func presenceHeartbeats() {
+	ticker := time.NewTicker(presence.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			all := clients.all()
+			conns := make([]presence.Connection, 0, len(all))
+			for _, client := range all {
+				conns = append(conns, presenceConnection(client))
+			}
+			// every connection is refreshed within its own timeout, see presence.Heartbeat
+			if err := presence.Heartbeat(context.Background(), conns); err != nil {
+				log.Println("presence heartbeat error:", err)
+			}
+		case <-stopPresence:
+			return
+		}
+	}
+}
+
+func presenceConnection(client ClientObject) presence.Connection {
+	return presence.Connection{
+		ID:          client.id,
+		User:        client.user,
+		UserType:    client.claims.UserType,
+		OrgID:       client.claims.OrgID,
+		Instance:    instanceID,
+		ConnectedAt: client.connectedAt,
+	}
+}
+
+// connectPresence queues the record of the connection, it returns at once
+func connectPresence(client ClientObject) {
+	if !trackPresence {
+		return
+	}
+	conn := presenceConnection(client)
+	presenceTasks.add(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+		defer cancel()
+		if err := presence.Connect(ctx, conn); err != nil {
+			log.Println("presence connect error:", err)
+		}
+	})
+}
+
+// disconnectPresence queues the removal of the connection, it returns at once
+func disconnectPresence(client ClientObject) {
+	if !trackPresence {
+		return
+	}
+	conn := presenceConnection(client)
+	presenceTasks.add(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+		defer cancel()
+		if err := presence.Disconnect(ctx, conn); err != nil {
+			log.Println("presence disconnect error:", err)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"go-event-management/internal/ingest"
+	"go-event-management/internal/metrics"
+	"go-event-management/pkg/events"
+	"log"
+	"time"
+)
+
+// Frame types of the client protocol
+const (
+	FrameEvent = "event"
+	FrameAck   = "ack"
+	FrameNack  = "nack"
+)
+
+// Ack modes, a client picks one with the ack query param at connect time
+const (
+	AckAccepted  = "accepted"  // ack once the event is queued for batching
+	AckDelivered = "delivered" // ack once the sink confirms the write
+)
+
+// Nack codes telling the client why an event was rejected
+const (
+	NackInvalidJSON       = ingest.CodeInvalidJSON
+	NackInvalidFrame      = "invalid_frame"
+	NackSchemaViolation   = ingest.CodeSchemaViolation
+	NackUnsupportedFrame  = "unsupported_frame"
+	NackOverloaded        = ingest.CodeOverloaded
+	NackDeliveryFailed    = ingest.CodeDeliveryFailed
+	NackInternal          = ingest.CodeInternal
+	NackInvalidChannel    = "invalid_channel"
+	NackForbidden         = "forbidden"
+	NackSubscriptionLimit = "subscription_limit"
+	NackThrottled         = "throttled"
+)
+
+const writeTimeout = 10 * time.Second
+
+// RequestFrame is the envelope clients send events in. Frames without an id
+// nor an event are treated as a bare EventMessage, which is accepted but never
+// acked, a frame with an id but no event is nacked.
+// Subscribe and unsubscribe frames carry a channel instead of an event.
+type RequestFrame struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Event   json.RawMessage `json:"event"`
+	Channel string          `json:"channel,omitempty"`
+}
+
+// ResponseFrame is the ack or nack sent back for a RequestFrame, a throttled
+// frame tells when the next one is accepted
+type ResponseFrame struct {
+	Type         string `json:"type"`
+	ID           string `json:"id"`
+	Code         string `json:"code,omitempty"`
+	Error        string `json:"error,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+// writeFrame writes the frame in the encoding of the connection and serialises
+// writes to it, acks in delivered mode are sent from the sink goroutines while
+// the read loop may be replying as well
+func (c ClientObject) writeFrame(v interface{}) error {
+	if c.stream != nil {
+		return c.stream.send(v)
+	}
+	frame, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	message, err := c.codec.encode(frame)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(c.codec.messageType(), message)
+}
+
+func (c ClientObject) ack(id string) {
+	if err := c.writeFrame(ResponseFrame{Type: FrameAck, ID: id}); err != nil {
+		log.Println("ack write error:", err)
+	}
+}
+
+func (c ClientObject) nack(id string, code string, reason error) {
+	metrics.MessagesNacked.WithLabelValues(code).Inc()
+	frame := ResponseFrame{Type: FrameNack, ID: id, Code: code}
+	if reason != nil {
+		frame.Error = reason.Error()
+	}
+	if err := c.writeFrame(frame); err != nil {
+		log.Println("nack write error:", err)
+	}
+}
+
+// rejectMessage nacks a message that couldn't be decoded with the encoding of the connection
+func (c ClientObject) rejectMessage(messageType int, err error) {
+	if errors.Is(err, ErrorUnsupportedFrame) {
+		log.Println("websocket message received of type", messageType)
+		c.nack("", NackUnsupportedFrame, err)
+		return
+	}
+	c.nack("", NackInvalidFrame, err)
+}
+
+// handleMessage processes a JSON frame decoded from the client and replies
+// with an ack or nack when the frame carries an id
+func (c ClientObject) handleMessage(message []byte) {
+	var frame RequestFrame
+	if err := json.Unmarshal(message, &frame); err != nil {
+		log.Println("message unmarshal error:", c.id, err)
+		events.DeadLetterPayload(message, err)
+		c.nack("", NackInvalidJSON, err)
+		return
+	}
+	if frame.Type == FrameSubscribe || frame.Type == FrameUnsubscribe {
+		c.handleSubscription(frame)
+		return
+	}
+	enveloped := len(frame.Event) > 0
+	if !enveloped && frame.ID != "" {
+		c.nack(frame.ID, NackInvalidFrame, errors.New("frame event is required"))
+		return
+	}
+	payload := message
+	if enveloped {
+		if frame.Type != "" && frame.Type != FrameEvent {
+			c.nack(frame.ID, NackUnsupportedFrame, errors.New("unknown frame type "+frame.Type))
+			return
+		}
+		if frame.ID == "" {
+			c.nack("", NackInvalidFrame, errors.New("frame id is required"))
+			return
+		}
+		payload = frame.Event
+	}
+
+	var done func(error)
+	if enveloped && c.ackMode == AckDelivered {
+		done = func(err error) {
+			if err != nil {
+				c.nack(frame.ID, NackDeliveryFailed, err)
+				return
+			}
+			c.ack(frame.ID)
+		}
+	}
+	err := ingest.Event(c.claims, payload, done)
+	if !enveloped {
+		return
+	}
+	if err != nil {
+		c.nack(frame.ID, ingest.ErrorCode(err), err)
+		return
+	}
+	if done == nil {
+		c.ack(frame.ID)
+	}
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"go-event-management/internal/auth"
+	"go-event-management/pkg/events"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// failingSink rejects every write, like a sink that is down
+type failingSink struct {
+	*events.MemorySink
+}
+
+func (failingSink) Write(ctx context.Context, batch []events.Message) error {
+	return errors.New("sink down")
+}
+
+// serveProtocol serves connections that hand every frame to handleMessage, in
+// the ack mode of the ack query param
+func serveProtocol(t *testing.T) string {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", websocket.New(func(c *websocket.Conn) {
+		clientObj := ClientObject{
+			id:      "c1",
+			user:    "u1",
+			claims:  &auth.Claims{UserID: "u1", UserType: "borrower"},
+			ackMode: c.Query("ack"),
+			codec:   jsonCodec{},
+			conn:    c,
+			writeMu: &sync.Mutex{},
+		}
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			clientObj.handleMessage(message)
+		}
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(lis)
+	t.Cleanup(func() { app.Shutdown() })
+	return lis.Addr().String()
+}
+
+func TestHandleMessage(t *testing.T) {
+	events.EventSink, events.EventLog, events.EventRoutes = events.NewMemorySink(), nil, nil
+	events.Batching = events.BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: 10 * time.Millisecond, Workers: 1, QueueSize: 100}
+	events.InitEvents()
+	defer events.Shutdown(context.Background())
+	defer func(attempts int) { events.DeliveryAttempts = attempts }(events.DeliveryAttempts)
+	events.DeliveryAttempts = 1
+	addr := serveProtocol(t)
+
+	type testStruct struct {
+		ackMode string
+		sink    events.Sink
+		message string
+		expType string
+		expID   string
+		expCode string
+	}
+	var testCases = []testStruct{
+		{AckAccepted, events.NewMemorySink(), `{"id":"f1","type":"event","event":{"event_type":"click"}}`, FrameAck, "f1", ""},
+		{AckAccepted, events.NewMemorySink(), `{"id":"f2","event":{"event_type":"click"}}`, FrameAck, "f2", ""},
+		{AckDelivered, events.NewMemorySink(), `{"id":"f3","type":"event","event":{"event_type":"click"}}`, FrameAck, "f3", ""},
+		{AckDelivered, failingSink{events.NewMemorySink()}, `{"id":"f4","type":"event","event":{"event_type":"click"}}`, FrameNack, "f4", NackDeliveryFailed},
+		{AckAccepted, events.NewMemorySink(), `not json`, FrameNack, "", NackInvalidJSON},
+		{AckAccepted, events.NewMemorySink(), `{"type":"event","event":{"event_type":"click"}}`, FrameNack, "", NackInvalidFrame},
+		{AckAccepted, events.NewMemorySink(), `{"id":"f7","type":"track","event":{"event_type":"click"}}`, FrameNack, "f7", NackUnsupportedFrame},
+		{AckAccepted, events.NewMemorySink(), `{"id":"f8","type":"event"}`, FrameNack, "f8", NackInvalidFrame},
+		{AckDelivered, events.NewMemorySink(), `{"id":"f9","event_type":"click"}`, FrameNack, "f9", NackInvalidFrame},
+	}
+	for index, test := range testCases {
+		events.EventSink = test.sink
+		conn, _, err := fastws.DefaultDialer.Dial("ws://"+addr+"/ws?ack="+test.ackMode, nil)
+		if err != nil {
+			t.Fatalf("Case %d: dial Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if err := conn.WriteMessage(fastws.TextMessage, []byte(test.message)); err != nil {
+			t.Fatalf("Case %d: write Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var frame ResponseFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("Case %d: read Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		conn.Close()
+		if frame.Type != test.expType || frame.ID != test.expID || frame.Code != test.expCode {
+			t.Errorf("Case %d: response frame Error: (expected: %s %q %s, got: %s %q %s)", index+1, test.expType, test.expID, test.expCode, frame.Type, frame.ID, frame.Code)
+		}
+		if test.expType == FrameNack && frame.Error == "" {
+			t.Errorf("Case %d: nack reason Error: (expected: a reason, got: none)", index+1)
+		}
+	}
+}
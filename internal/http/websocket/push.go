@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"go-event-management/internal/metrics"
+	"log"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// FrameNotification is the frame type of notifications pushed to clients
+const FrameNotification = "notification"
+
+// Delivery statuses of a pushed notification, per connection
+const (
+	DeliveryDelivered = "delivered" // written to the connection
+	DeliveryFailed    = "failed"
+)
+
+var ErrorInvalidNotification = errors.New("websocket: notification must be a JSON object")
+
+// NotificationFrame is the frame a notification is pushed in, id lets clients drop duplicates
+type NotificationFrame struct {
+	Type         string          `json:"type"`
+	ID           string          `json:"id"`
+	Channel      string          `json:"channel,omitempty"` // set when pushed to the subscribers of a channel
+	Notification json.RawMessage `json:"notification"`
+}
+
+// DeliveryStatus is the outcome of a push to a single connection
+type DeliveryStatus struct {
+	ConnectionID string `json:"connection_id"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+}
+
+// PushResult tells which connections of this instance a notification reached,
+// and how many other instances it was relayed to for the connections they hold
+type PushResult struct {
+	ID              string           `json:"id"`
+	User            string           `json:"user,omitempty"`
+	Channel         string           `json:"channel,omitempty"`
+	Delivered       int              `json:"delivered"`
+	Connections     []DeliveryStatus `json:"connections"`
+	RemoteInstances int64            `json:"remote_instances"`
+	RelayError      string           `json:"relay_error,omitempty"`
+}
+
+// PushRequest is the body of PushHandler, the notification goes either to the
+// connections of a user or to the subscribers of a channel
+type PushRequest struct {
+	UserID       string          `json:"user_id"`
+	Channel      string          `json:"channel"`
+	Notification json.RawMessage `json:"notification"`
+}
+
+// Push writes the notification to every open connection of the user on this
+// instance at once, and relays it through redis to the other instances when
+// StartRelay was called. A user without connections gets a result with no deliveries.
+func Push(user string, notification json.RawMessage) (PushResult, error) {
+	frame, err := newNotificationFrame("", notification)
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	result := deliverUser(user, frame)
+	recordHistory(userFeed(user), frame)
+	if relay != nil {
+		envelope := relayEnvelope{Origin: instanceID, User: user, Frame: frame}
+		remote, err := publishNotification(envelope, len(result.Connections) > 0)
+		if err != nil {
+			log.Println("notification relay error:", err)
+			result.RelayError = err.Error()
+		}
+		result.RemoteInstances = remote
+	}
+	return result, nil
+}
+
+// PushAll writes the notification to every open connection, on this instance
+// and on the others when StartRelay was called
+func PushAll(notification json.RawMessage) (PushResult, error) {
+	frame, err := newNotificationFrame("", notification)
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	result := deliver(clients.all(), frame)
+	recordHistory(allFeed, frame)
+	if relay != nil {
+		envelope := relayEnvelope{Origin: instanceID, All: true, Frame: frame}
+		remote, err := publishNotification(envelope, true)
+		if err != nil {
+			log.Println("notification relay error:", err)
+			result.RelayError = err.Error()
+		}
+		result.RemoteInstances = remote
+	}
+	return result, nil
+}
+
+// newNotificationFrame checks the notification is a JSON object and wraps it in a frame
+func newNotificationFrame(channel string, notification json.RawMessage) (NotificationFrame, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(notification, &fields); err != nil || fields == nil {
+		return NotificationFrame{}, ErrorInvalidNotification
+	}
+	return NotificationFrame{Type: FrameNotification, ID: uuid.NewString(), Channel: channel, Notification: notification}, nil
+}
+
+// deliverUser writes the frame to the connections of the user on this instance
+func deliverUser(user string, frame NotificationFrame) PushResult {
+	result := deliver(clients.userConnections(user), frame)
+	result.User = user
+	return result
+}
+
+// deliverChannel writes the frame to the subscribers of the channel on this instance
+func deliverChannel(channel string, frame NotificationFrame) PushResult {
+	result := deliver(clients.channelConnections(channel), frame)
+	result.Channel = channel
+	return result
+}
+
+// deliver writes the frame to the connections at once
+func deliver(conns []ClientObject, frame NotificationFrame) PushResult {
+	result := PushResult{ID: frame.ID, Connections: make([]DeliveryStatus, len(conns))}
+	var wg sync.WaitGroup
+	for index, client := range conns {
+		wg.Add(1)
+		go func(index int, client ClientObject) {
+			defer wg.Done()
+			status := DeliveryStatus{ConnectionID: client.id, Status: DeliveryDelivered}
+			if err := client.writeFrame(frame); err != nil {
+				status.Status, status.Error = DeliveryFailed, err.Error()
+			}
+			metrics.NotificationsPushed.WithLabelValues(status.Status).Inc()
+			result.Connections[index] = status
+		}(index, client)
+	}
+	wg.Wait()
+
+	for _, status := range result.Connections {
+		if status.Status == DeliveryDelivered {
+			result.Delivered++
+		}
+	}
+	return result
+}
+
+// PushHandler pushes the notification of a PushRequest and responds with the PushResult
+func PushHandler(c *fiber.Ctx) error {
+	var req PushRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "body must be a JSON object"})
+	}
+	if (req.UserID == "") == (req.Channel == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "either user_id or channel is required"})
+	}
+	push := Push
+	target := req.UserID
+	if req.Channel != "" {
+		push, target = Broadcast, req.Channel
+	}
+	result, err := push(target, req.Notification)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"go-event-management/internal/metrics"
+	"go-event-management/internal/ratelimit"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+const (
+	rateLimitTimeout = 500 * time.Millisecond // frames are let through when redis is slower
+	rateLimitBackoff = 5 * time.Second        // frames aren't limited for this long after redis failed
+	throttleSpan     = time.Minute            // span throttled frames are counted over for ThrottleCloseAfter
+)
+
+// rateLimitSkipUntil is the unix nanos until which frames aren't limited,
+// so that a redis outage doesn't slow every frame down by rateLimitTimeout
+var rateLimitSkipUntil atomic.Int64
+
+// throttleWindow counts the throttled frames of a connection, it is only
+// used by the read loop
+type throttleWindow struct {
+	count int
+	since time.Time
+}
+
+// add counts a throttled frame and returns the count within the current span
+func (w *throttleWindow) add(now time.Time) int {
+	if now.Sub(w.since) >= throttleSpan {
+		w.count, w.since = 0, now
+	}
+	w.count++
+	return w.count
+}
+
+// allowMessage takes a token from the buckets of the user and of the
+// connection, a throttled frame is nacked. Frames are let through when redis
+// can't be reached, so that events aren't lost to an outage.
+func (c ClientObject) allowMessage(message []byte) bool {
+	if !ratelimit.Enabled() || time.Now().UnixNano() < rateLimitSkipUntil.Load() {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rateLimitTimeout)
+	defer cancel()
+	wait, err := ratelimit.Allow(ctx, c.claims.UserType, c.user, c.id)
+	if err != nil {
+		log.Println("rate limit error:", err)
+		rateLimitSkipUntil.Store(time.Now().Add(rateLimitBackoff).UnixNano())
+		return true
+	}
+	if wait == 0 {
+		return true
+	}
+
+	// the id is read on a best effort basis, so that the client knows which frame to resend
+	var frame RequestFrame
+	json.Unmarshal(message, &frame)
+	metrics.MessagesNacked.WithLabelValues(NackThrottled).Inc()
+	response := ResponseFrame{Type: FrameNack, ID: frame.ID, Code: NackThrottled, Error: "rate limit exceeded", RetryAfterMs: wait.Milliseconds()}
+	if err := c.writeFrame(response); err != nil {
+		log.Println("nack write error:", err)
+	}
+	return false
+}
+
+// closeRateLimited disconnects a client that kept sending while throttled
+func (c ClientObject) closeRateLimited() {
+	metrics.WebsocketReaped.WithLabelValues(reapedRateLimited).Inc()
+	log.Println("client reaped, rate limited:", c.user, c.id)
+	message := websocket.FormatCloseMessage(CloseRateLimited, "rate limit exceeded")
+	if err := c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeWriteTimeout)); err != nil {
+		log.Println("close write error:", err)
+	}
+}
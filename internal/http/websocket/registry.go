@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+)
+
+// maxSubscriptions bounds the channels a single connection subscribes to
+const maxSubscriptions = 100
+
+var (
+	ErrorNotRegistered     = errors.New("websocket: connection is not registered")
+	ErrorSubscriptionLimit = errors.New("websocket: too many channel subscriptions")
+)
+
+// connectionRegistry holds the open connections keyed by connection id, with
+// an index of the connections of every user so that a user can have several
+// sessions open at once, and of the connections subscribed to every channel
+type connectionRegistry struct {
+	mu            sync.RWMutex
+	conns         map[string]ClientObject
+	users         map[string]map[string]struct{}
+	channels      map[string]map[string]struct{} // connection ids by channel
+	subscriptions map[string]map[string]struct{} // channels by connection id
+}
+
+func newConnectionRegistry() *connectionRegistry {
+	return &connectionRegistry{
+		conns:         make(map[string]ClientObject),
+		users:         make(map[string]map[string]struct{}),
+		channels:      make(map[string]map[string]struct{}),
+		subscriptions: make(map[string]map[string]struct{}),
+	}
+}
+
+// add registers the connection and reports whether it is the first one of the user
+func (r *connectionRegistry) add(client ClientObject) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conns[client.id] = client
+	first := r.users[client.user] == nil
+	if first {
+		r.users[client.user] = make(map[string]struct{})
+	}
+	r.users[client.user][client.id] = struct{}{}
+	return first
+}
+
+// remove drops the connection and reports whether it was registered, and
+// whether it was the last one of the user
+func (r *connectionRegistry) remove(client ClientObject) (removed bool, last bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[client.id]; !ok {
+		return false, false
+	}
+	delete(r.conns, client.id)
+	delete(r.users[client.user], client.id)
+	if len(r.users[client.user]) == 0 {
+		delete(r.users, client.user)
+		last = true
+	}
+	return true, last
+}
+
+// all returns every open connection
+func (r *connectionRegistry) all() []ClientObject {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]ClientObject, 0, len(r.conns))
+	for _, client := range r.conns {
+		result = append(result, client)
+	}
+	return result
+}
+
+// count returns the number of open connections
+func (r *connectionRegistry) count() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.conns)
+}
+
+// userConnections returns the open connections of a user
+func (r *connectionRegistry) userConnections(user string) []ClientObject {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]ClientObject, 0, len(r.users[user]))
+	for id := range r.users[user] {
+		result = append(result, r.conns[id])
+	}
+	return result
+}
+
+// subscribe adds the connection to the subscribers of the channel and reports
+// whether it is the first subscriber of the channel
+func (r *connectionRegistry) subscribe(id string, channel string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[id]; !ok {
+		return false, ErrorNotRegistered
+	}
+	if _, ok := r.subscriptions[id][channel]; ok {
+		return false, nil
+	}
+	if len(r.subscriptions[id]) >= maxSubscriptions {
+		return false, ErrorSubscriptionLimit
+	}
+	if r.subscriptions[id] == nil {
+		r.subscriptions[id] = make(map[string]struct{})
+	}
+	r.subscriptions[id][channel] = struct{}{}
+	first := r.channels[channel] == nil
+	if first {
+		r.channels[channel] = make(map[string]struct{})
+	}
+	r.channels[channel][id] = struct{}{}
+	return first, nil
+}
+
+// unsubscribe removes the connection from the subscribers of the channel and
+// reports whether it was the last subscriber of the channel
+func (r *connectionRegistry) unsubscribe(id string, channel string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropSubscription(id, channel)
+}
+
+// unsubscribeAll removes the subscriptions of the connection, it returns the
+// channels left without subscribers
+func (r *connectionRegistry) unsubscribeAll(id string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var emptied []string
+	for channel := range r.subscriptions[id] {
+		if r.dropSubscription(id, channel) {
+			emptied = append(emptied, channel)
+		}
+	}
+	return emptied
+}
+
+func (r *connectionRegistry) dropSubscription(id string, channel string) bool {
+	if _, ok := r.subscriptions[id][channel]; !ok {
+		return false
+	}
+	delete(r.subscriptions[id], channel)
+	if len(r.subscriptions[id]) == 0 {
+		delete(r.subscriptions, id)
+	}
+	delete(r.channels[channel], id)
+	if len(r.channels[channel]) == 0 {
+		delete(r.channels, channel)
+		return true
+	}
+	return false
+}
+
+// channelConnections returns the connections subscribed to a channel
+func (r *connectionRegistry) channelConnections(channel string) []ClientObject {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]ClientObject, 0, len(r.channels[channel]))
+	for id := range r.channels[channel] {
+		result = append(result, r.conns[id])
+	}
+	return result
+}
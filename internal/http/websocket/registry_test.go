@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"go-event-management/internal/auth"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestChannelSubscriptions(t *testing.T) {
+	r := newConnectionRegistry()
+	r.add(ClientObject{id: "c1", user: "u1"})
+	r.add(ClientObject{id: "c2", user: "u2"})
+
+	type testStruct struct {
+		op       string // subscribe, unsubscribe or remove
+		id       string
+		channel  string
+		expFirst bool // first subscriber, or last one for unsubscribe
+		expErr   error
+	}
+	var testCases = []testStruct{
+		{"subscribe", "c1", "loan:1", true, nil},
+		{"subscribe", "c2", "loan:1", false, nil},
+		{"subscribe", "c1", "loan:1", false, nil},
+		{"subscribe", "c1", "loan:2", true, nil},
+		{"subscribe", "c3", "loan:1", false, ErrorNotRegistered},
+		{"unsubscribe", "c2", "loan:1", false, nil},
+		{"unsubscribe", "c2", "loan:1", false, nil},
+		{"unsubscribe", "c1", "loan:1", true, nil},
+	}
+	for index, test := range testCases {
+		var got bool
+		var err error
+		if test.op == "subscribe" {
+			got, err = r.subscribe(test.id, test.channel)
+		} else {
+			got = r.unsubscribe(test.id, test.channel)
+		}
+		if err != test.expErr {
+			t.Errorf("Case %d: %s Error: (expected: %v, got: %v)", index+1, test.op, test.expErr, err)
+		}
+		if got != test.expFirst {
+			t.Errorf("Case %d: %s Error: (expected: %t, got: %t)", index+1, test.op, test.expFirst, got)
+		}
+	}
+
+	// subscriptions of a removed connection go away with it
+	r.subscribe("c2", "loan:2")
+	r.remove(ClientObject{id: "c1", user: "u1"})
+	if emptied := r.unsubscribeAll("c1"); len(emptied) != 0 {
+		t.Errorf("unsubscribeAll Error: (expected: none, got: %v)", emptied)
+	}
+	r.subscribe("c2", "loan:3")
+	emptied := r.unsubscribeAll("c2")
+	sort.Strings(emptied)
+	if got := strings.Join(emptied, ","); got != "loan:2,loan:3" {
+		t.Errorf("unsubscribeAll Error: (expected: loan:2,loan:3, got: %s)", got)
+	}
+	if conns := r.channelConnections("loan:2"); len(conns) != 0 {
+		t.Errorf("channelConnections Error: (expected: none, got: %d)", len(conns))
+	}
+
+	for i := 0; i < maxSubscriptions; i++ {
+		r.subscribe("c2", "loan:"+strconv.Itoa(i))
+	}
+	if _, err := r.subscribe("c2", "loan:limit"); err != ErrorSubscriptionLimit {
+		t.Errorf("subscribe Error: (expected: %v, got: %v)", ErrorSubscriptionLimit, err)
+	}
+}
+
+func TestAuthorizeChannel(t *testing.T) {
+	config.ChannelUserTypes = map[string][]string{"loan": {"lender", "service"}}
+	config.ChannelAnyOrgUserTypes = []string{"service"}
+	type testStruct struct {
+		userType string
+		org      string
+		channel  string
+		expErr   error
+	}
+	var testCases = []testStruct{
+		{"lender", "o-1", "loan:o-1:la-1", nil},
+		{"lender", "o-1", "loan:o-1:la:1", nil},
+		{"lender", "o-2", "loan:o-1:la-1", ErrorChannelForbidden},
+		{"lender", "", "loan:o-1:la-1", ErrorChannelForbidden},
+		{"service", "", "loan:o-1:la-1", nil},
+		{"borrower", "o-1", "loan:o-1:la-1", ErrorChannelForbidden},
+		{"lender", "o-1", "org:o-1:o-1", ErrorInvalidChannel},
+		{"lender", "o-1", "loan:la-1", ErrorInvalidChannel},
+		{"lender", "o-1", "loan::la-1", ErrorInvalidChannel},
+		{"lender", "o-1", "loan:o-1:", ErrorInvalidChannel},
+		{"lender", "o-1", "loan", ErrorInvalidChannel},
+		{"lender", "o-1", "loan:o-1:" + strings.Repeat("x", maxChannelLength), ErrorInvalidChannel},
+	}
+	for index, test := range testCases {
+		err := authorizeChannel(&auth.Claims{UserType: test.userType, OrgID: test.org}, test.channel)
+		if err != test.expErr {
+			t.Errorf("Case %d: authorizeChannel Error: (expected: %v, got: %v)", index+1, test.expErr, err)
+		}
+	}
+}
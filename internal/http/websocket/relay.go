@@ -0,0 +1,155 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"go-event-management/internal/repository/redis"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// allChannel relays the notifications pushed to every connection
+const allChannel = "ws:all"
+
+// relayTimeout bounds the redis calls made while registering connections
+const relayTimeout = 5 * time.Second
+
+// relayTasks makes the relay subscriptions of the hub in order, off the hub goroutine
+var relayTasks = newTaskQueue()
+
+// instanceID tells the notifications published by this instance apart from the others
+var instanceID = uuid.NewString()
+
+// relay is the subscription to the channels of the users connected to this
+// instance, nil when notifications are delivered to local connections only
+var relay *redis.Subscription
+
+// relayEnvelope is published on the redis channel of a user or of a channel,
+// so that the instances holding their connections deliver the notification
+type relayEnvelope struct {
+	Origin  string            `json:"origin"`
+	User    string            `json:"user,omitempty"`
+	Channel string            `json:"channel,omitempty"`
+	All     bool              `json:"all,omitempty"`
+	Frame   NotificationFrame `json:"frame"`
+}
+
+// redisChannel returns the redis channel the envelope is published on
+func (e relayEnvelope) redisChannel() string {
+	if e.All {
+		return allChannel
+	}
+	if e.Channel != "" {
+		return subscriptionChannel(e.Channel)
+	}
+	return userChannel(e.User)
+}
+
+// userChannel returns the redis channel the notifications of a user are relayed on
+func userChannel(user string) string {
+	return "ws:user:" + user
+}
+
+// subscriptionChannel returns the redis channel the notifications of a channel are relayed on
+func subscriptionChannel(channel string) string {
+	return "ws:channel:" + channel
+}
+
+// StartRelay subscribes to redis so that notifications pushed on any instance
+// reach the users connected to this one. Channels are subscribed to as users
+// connect, so it needs to be called before serving connections.
+func StartRelay(ctx context.Context) error {
+	sub, err := redis.Subscribe(ctx, allChannel)
+	if err != nil {
+		return err
+	}
+	relay = sub
+	go receiveRelayed(sub)
+	go relayTasks.run()
+	return nil
+}
+
+func receiveRelayed(sub *redis.Subscription) {
+	for msg := range sub.Messages() {
+		var envelope relayEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+			log.Println("relayed notification unmarshal error:", err)
+			continue
+		}
+		if envelope.Origin == instanceID {
+			continue // delivered when it was pushed
+		}
+		if envelope.All {
+			deliver(clients.all(), envelope.Frame)
+			continue
+		}
+		if envelope.Channel != "" {
+			deliverChannel(envelope.Channel, envelope.Frame)
+			continue
+		}
+		deliverUser(envelope.User, envelope.Frame)
+	}
+}
+
+// publishNotification relays the envelope to the other instances, it returns how many of them received it
+func publishNotification(envelope relayEnvelope, local bool) (int64, error) {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return 0, err
+	}
+	receivers, err := redis.Publish(context.Background(), envelope.redisChannel(), string(payload))
+	if err != nil {
+		return 0, err
+	}
+	// this instance is subscribed as well while it holds connections of the user or channel
+	if local && receivers > 0 {
+		receivers--
+	}
+	return receivers, nil
+}
+
+func subscribeUser(user string) {
+	subscribeRelay(userChannel(user))
+}
+
+func unsubscribeUser(user string) {
+	unsubscribeRelay(userChannel(user))
+}
+
+func subscribeChannel(channel string) {
+	subscribeRelay(subscriptionChannel(channel))
+}
+
+func unsubscribeChannel(channel string) {
+	unsubscribeRelay(subscriptionChannel(channel))
+}
+
+// subscribeRelay queues the subscription to the redis channel, it returns at once
+func subscribeRelay(redisChannel string) {
+	if relay == nil {
+		return
+	}
+	relayTasks.add(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+		defer cancel()
+		if err := relay.Subscribe(ctx, redisChannel); err != nil {
+			log.Println("relay subscribe error:", err)
+		}
+	})
+}
+
+// unsubscribeRelay queues the unsubscription from the redis channel, it returns at once
+func unsubscribeRelay(redisChannel string) {
+	if relay == nil {
+		return
+	}
+	relayTasks.add(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+		defer cancel()
+		if err := relay.Unsubscribe(ctx, redisChannel); err != nil {
+			log.Println("relay unsubscribe error:", err)
+		}
+	})
+}
@@ -1,26 +1,140 @@
 package websocket
 
 import (
-	"encoding/json"
-	"fmt"
-	"go-event-management/pkg/events"
+	"context"
+	"errors"
+	"go-event-management/internal/auth"
+	"go-event-management/internal/metrics"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-func removeClient(user string) {
-	if conn, ok := clients[user]; ok { // Check if client exists
-		delete(clients, user)
-		conn.Close()
+// Init sets up the websocket settings, it needs to be called before serving connections
+func Init(cfg Config) {
+	if cfg.AckMode != AckAccepted && cfg.AckMode != AckDelivered {
+		cfg.AckMode = AckAccepted
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = defaultPingInterval
+	}
+	if cfg.PongTimeout <= 0 {
+		cfg.PongTimeout = defaultPongTimeout
+	}
+	if cfg.ThrottleCloseAfter <= 0 {
+		cfg.ThrottleCloseAfter = defaultThrottleCloseAfter
+	}
+	config = cfg
+}
+
+// Shutdown stops accepting upgrades and sends a going away close frame to every
+// client, it returns once the clients are gone. Connections still open when
+// ctx is done are closed without waiting for the client. Only the first call
+// shuts down, later calls wait for it and return its error.
+func Shutdown(ctx context.Context) error {
+	shutdownOnce.Do(func() { shutdownErr = shutdown(ctx) })
+	return shutdownErr
+}
+
+func shutdown(ctx context.Context) error {
+	draining.Store(true)
+	deadline := time.Now().Add(closeWriteTimeout)
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+	for _, client := range clients.all() {
+		if client.stream != nil {
+			client.stream.close() // the client reconnects to another instance with its Last-Event-ID
+			continue
+		}
+		if err := client.conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+			log.Println("close write error:", err)
+		}
+	}
+
+	if relay != nil {
+		defer relay.Close()
+	}
+	if trackPresence {
+		close(stopPresence)
+	}
+
+	ticker := time.NewTicker(shutdownPoll)
+	defer ticker.Stop()
+	for clients.count() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			for _, client := range clients.all() {
+				removeClient(client)
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// CheckAccepting reports whether new connections are accepted, they are not once Shutdown is called
+func CheckAccepting(ctx context.Context) error {
+	if draining.Load() {
+		return errors.New("websocket: server is shutting down")
+	}
+	return nil
+}
+
+// removeClient unregisters and closes only the given connection, other
+// connections of the same user stay open
+func removeClient(client ClientObject) {
+	removed, last := clients.remove(client)
+	if removed {
+		client.connectionGauge().Dec()
+		if client.stream != nil {
+			client.stream.close()
+		} else {
+			client.conn.Close()
+		}
+		disconnectPresence(client)
+	}
+	for _, channel := range clients.unsubscribeAll(client.id) {
+		unsubscribeChannel(channel)
+	}
+	if last {
+		unsubscribeUser(client.user)
 	}
 }
 
+// rejectConnection closes a connection whose token failed verification with a
+// close code that tells the client whether refreshing the token can help
+func rejectConnection(c *websocket.Conn, err error) {
+	code, result := CloseTokenInvalid, "token_invalid"
+	if errors.Is(err, auth.ErrorTokenExpired) {
+		code, result = CloseTokenExpired, "token_expired"
+	}
+	metrics.WebsocketUpgrades.WithLabelValues(result).Inc()
+	deadline := time.Now().Add(closeWriteTimeout)
+	if err := c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, err.Error()), deadline); err != nil {
+		log.Println("close write error:", err)
+	}
+	c.Close()
+}
+
 func EventCont(c *websocket.Conn) {
+	if err, ok := c.Locals("authError").(error); ok {
+		rejectConnection(c, err)
+		return
+	}
+	claims := c.Locals("claims").(*auth.Claims)
 	clientObj := ClientObject{
-		user: c.Locals("user").(string),
-		conn: c,
+		id:          uuid.NewString(),
+		user:        claims.UserID,
+		claims:      claims,
+		ackMode:     c.Locals("ackMode").(string),
+		codec:       connectionCodec(c),
+		connectedAt: time.Now(),
+		conn:        c,
+		writeMu:     &sync.Mutex{},
 	}
 	defer func() {
 		unregister <- clientObj
@@ -28,42 +142,99 @@ func EventCont(c *websocket.Conn) {
 	}()
 
 	// Register the client
+	metrics.WebsocketUpgrades.WithLabelValues("accepted").Inc()
 	register <- clientObj
 
+	heartbeat := newHeartbeat(c)
+	defer heartbeat.stop()
+	var throttled throttleWindow
+
 	for {
 		messageType, message, err := c.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if isTimeout(err) {
+				metrics.WebsocketReaped.WithLabelValues(reapedPongTimeout).Inc()
+				log.Println("client reaped, pong timeout:", clientObj.user, clientObj.id)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Println("read error:", err)
 			}
 
 			return // Calls the deferred function, i.e. closes the connection on error
 		}
-		var EventMessage events.EventMessage
-		fmt.Println(string(message))
-		err = json.Unmarshal(message, &EventMessage)
-		if err != nil {
-			log.Println("can not Unmarshal message")
-		}
-		if messageType == websocket.TextMessage {
-			// Broadcast the received message
-			broadcast <- BroadcastObject{
-				EventMessage: EventMessage,
-				from:         clientObj,
+		heartbeat.received()
+		// every frame is charged to the buckets, undecodable ones included, so
+		// that garbage can't be sent past the rate limit. The decoded frame only
+		// gives the throttled nack its id.
+		frame, decodeErr := clientObj.codec.decode(messageType, message)
+		if !clientObj.allowMessage(frame) {
+			if throttled.add(time.Now()) >= config.ThrottleCloseAfter {
+				clientObj.closeRateLimited()
+				return
 			}
-		} else {
-			log.Println("websocket message received of type", messageType)
+			continue
 		}
+		if decodeErr != nil {
+			clientObj.rejectMessage(messageType, decodeErr)
+			continue
+		}
+		clientObj.handleMessage(frame)
+	}
+}
+
+// requestToken returns the bearer token of the request, browsers cannot set
+// headers on a websocket upgrade so the token query param is accepted as well
+func requestToken(c *fiber.Ctx) string {
+	if token := auth.BearerToken(c.Get(fiber.HeaderAuthorization)); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// requestAckMode returns the ack mode asked for with the ack query param
+func requestAckMode(c *fiber.Ctx) string {
+	switch mode := c.Query("ack"); mode {
+	case AckAccepted, AckDelivered:
+		return mode
 	}
+	return config.AckMode
 }
+
+// connectionCodec returns the codec of the encoding negotiated with a
+// subprotocol, or else asked for with the encoding query param
+func connectionCodec(c *websocket.Conn) codec {
+	encoding := subprotocolEncoding(c.Subprotocol())
+	if encoding == "" {
+		encoding, _ = c.Locals("encoding").(string)
+	}
+	frameCodec, err := newCodec(encoding)
+	if err != nil {
+		return jsonCodec{} // the middleware rejects unknown encodings before the upgrade
+	}
+	return frameCodec
+}
+
 func EventRequestMiddleWare(c *fiber.Ctx) error {
+	if draining.Load() {
+		return fiber.ErrServiceUnavailable
+	}
 	if websocket.IsWebSocketUpgrade(c) {
+		encoding := c.Query("encoding")
+		if _, err := newCodec(encoding); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 		c.Locals("allowed", true)
-		fmt.Println("here")
-		// Your authentication process goes here. Get the Token from header and validate it
-		// Extract the claims from the token and set them to the Locals
-		// This is because you cannot access headers in the websocket.Conn object below
-		c.Locals("user", string(c.Request().Header.Peek("user")))
+		c.Locals("encoding", encoding)
+		// Headers cannot be accessed in the websocket.Conn object, so the verified
+		// claims are set to the Locals. A rejected token is still upgraded so that
+		// the client receives a close code instead of an opaque handshake failure
+		claims, err := auth.ParseToken(requestToken(c))
+		if err != nil {
+			c.Locals("authError", err)
+			return c.Next()
+		}
+		c.Locals("claims", claims)
+		c.Locals("user", claims.UserID)
+		c.Locals("ackMode", requestAckMode(c))
 		return c.Next()
 	}
 	return fiber.ErrUpgradeRequired
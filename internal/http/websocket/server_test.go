@@ -0,0 +1,30 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestShutdownTwice(t *testing.T) {
+	defer func() {
+		trackPresence, stopPresence = false, make(chan struct{})
+		shutdownOnce, shutdownErr = sync.Once{}, nil
+		draining.Store(false)
+	}()
+	trackPresence = true
+
+	for index := 0; index < 2; index++ {
+		if err := Shutdown(context.Background()); err != nil {
+			t.Errorf("Case %d: Shutdown Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+	}
+	select {
+	case <-stopPresence:
+	default:
+		t.Errorf("Shutdown Error: (expected: presence stopped, got: running)")
+	}
+	if err := CheckAccepting(context.Background()); err == nil {
+		t.Errorf("CheckAccepting Error: (expected: an error, got: nil)")
+	}
+}
@@ -0,0 +1,193 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-event-management/internal/auth"
+	"go-event-management/internal/http/middleware"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	sseKeepAlive = 15 * time.Second // comment lines keep proxies from closing idle streams
+	sseBuffer    = 64               // frames queued for a stream, pushes fail while it is full
+	sseRetry     = 3 * time.Second  // reconnect delay advertised to EventSource
+)
+
+var (
+	ErrorStreamClosed = errors.New("websocket: event stream is closed")
+	ErrorStreamFull   = errors.New("websocket: event stream is not keeping up")
+)
+
+// sseStream queues the notifications of a client of SSEHandler for its writer
+type sseStream struct {
+	frames chan NotificationFrame
+	done   chan struct{}
+	once   *sync.Once
+}
+
+func newSSEStream() *sseStream {
+	return &sseStream{
+		frames: make(chan NotificationFrame, sseBuffer),
+		done:   make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+// send queues a notification frame, other frames are dropped as streams are read-only
+func (s *sseStream) send(v interface{}) error {
+	frame, ok := v.(NotificationFrame)
+	if !ok {
+		return nil
+	}
+	select {
+	case <-s.done:
+		return ErrorStreamClosed
+	default:
+	}
+	select {
+	case s.frames <- frame:
+		return nil
+	default:
+		return ErrorStreamFull
+	}
+}
+
+func (s *sseStream) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// SSEHandler streams the notifications of the user as server-sent events, for
+// clients whose network blocks websocket upgrades. The token is read like on
+// upgrades, from the authorization header or the token query param, and
+// channel query params subscribe the stream to channels. A client that
+// reconnects with Last-Event-ID, or the last_event_id query param, first gets
+// the notifications it missed.
+func SSEHandler(c *fiber.Ctx) error {
+	if draining.Load() {
+		return fiber.ErrServiceUnavailable
+	}
+	claims, err := auth.ParseToken(requestToken(c))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": middleware.TokenError(err)})
+	}
+	var channels []string
+	for _, value := range c.Context().QueryArgs().PeekMulti("channel") {
+		channel := string(value)
+		if err := authorizeChannel(claims, channel); errors.Is(err, ErrorChannelForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		channels = append(channels, channel)
+	}
+	if len(channels) > maxSubscriptions {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": ErrorSubscriptionLimit.Error()})
+	}
+	lastEventID := c.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	client := ClientObject{
+		id:          uuid.NewString(),
+		user:        claims.UserID,
+		claims:      claims,
+		connectedAt: time.Now(),
+		stream:      newSSEStream(),
+		writeMu:     &sync.Mutex{},
+	}
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // nginx would buffer the stream otherwise
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamNotifications(w, client, channels, lastEventID)
+	})
+	return nil
+}
+
+// streamNotifications registers the client with the hub and writes its
+// notifications until the client goes away or the server shuts down
+func streamNotifications(w *bufio.Writer, client ClientObject, channels []string, lastEventID string) {
+	register <- client
+	log.Println("sse stream opened:", client.user, client.id)
+	defer func() {
+		unregister <- client
+	}()
+	feeds := []string{userFeed(client.user), allFeed}
+	for _, channel := range channels {
+		sub := subscription{client: client, channel: channel, result: make(chan error, 1)}
+		subscribe <- sub
+		if err := <-sub.result; err != nil {
+			log.Println("sse subscribe error:", err)
+		}
+		feeds = append(feeds, channelFeed(channel))
+	}
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+		return
+	}
+	// notifications pushed while replaying are queued as well, they are written once
+	replayed := map[string]bool{}
+	if lastEventID != "" && config.NotificationHistory > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+		frames, err := replayHistory(ctx, feeds, lastEventID)
+		cancel()
+		if err != nil {
+			log.Println("notification history replay error:", err)
+		}
+		for _, frame := range frames {
+			if err := writeEvent(w, frame); err != nil {
+				return
+			}
+			replayed[frame.ID] = true
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case frame := <-client.stream.frames:
+			if replayed[frame.ID] {
+				continue
+			}
+			if err := writeEvent(w, frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		case <-client.stream.done:
+			return
+		}
+	}
+}
+
+// writeEvent writes the frame as an event whose id is the id of the notification
+func writeEvent(w *bufio.Writer, frame NotificationFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", frame.ID, FrameNotification, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,45 @@
+package websocket
+
+import "sync"
+
+// taskQueue runs tasks one at a time in the order they were added, so that the
+// redis calls of the hub are made off the hub goroutine without reordering a
+// subscribe and the unsubscribe that follows it. add never blocks, the queue
+// grows while redis is slow.
+type taskQueue struct {
+	mu    sync.Mutex
+	tasks []func()
+	wake  chan struct{}
+}
+
+func newTaskQueue() *taskQueue {
+	return &taskQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *taskQueue) add(task func()) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default: // the worker is awake already and picks the task up
+	}
+}
+
+// run runs the tasks as they are added, it never returns
+func (q *taskQueue) run() {
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			if len(q.tasks) == 0 {
+				q.mu.Unlock()
+				break
+			}
+			task := q.tasks[0]
+			q.tasks[0] = nil
+			q.tasks = q.tasks[1:]
+			q.mu.Unlock()
+			task()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package websocket
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskQueue(t *testing.T) {
+	q := newTaskQueue()
+	go q.run()
+
+	// a slow task doesn't block add, the tasks still run in order
+	release := make(chan struct{})
+	ran := make(chan string, 10)
+	q.add(func() { <-release })
+	added := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			i := i
+			q.add(func() { ran <- strconv.Itoa(i) })
+		}
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("add Error: (expected: returns while a task runs, got: blocked)")
+	}
+	close(release)
+
+	var got []string
+	for len(got) < 5 {
+		select {
+		case id := <-ran:
+			got = append(got, id)
+		case <-time.After(time.Second):
+			t.Fatalf("run Error: (expected: 5 tasks, got: %d)", len(got))
+		}
+	}
+	if order := strings.Join(got, ","); order != "0,1,2,3,4" {
+		t.Errorf("run Error: (expected: 0,1,2,3,4, got: %s)", order)
+	}
+}
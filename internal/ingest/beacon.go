@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"go-event-management/internal/auth"
+	"go-event-management/pkg/events"
+	"log"
+	"mime"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxBeaconBytes is the most browsers queue for navigator.sendBeacon
+const maxBeaconBytes = 64 << 10
+
+// Beacon is the text/plain body of BeaconHandler. sendBeacon can't set
+// headers, so the token travels in the body.
+type Beacon struct {
+	Token  string          `json:"token"`
+	Events json.RawMessage `json:"events"` // an event or an array of them
+}
+
+// BeaconHandler ingests the events a page sends with navigator.sendBeacon on
+// unload, as a text/plain Beacon, or as a form with the token and events
+// fields. It responds 204 once the events are queued, without waiting for
+// delivery; rejected events are dead-lettered since nobody reads the response,
+// including the valid ones the pipeline couldn't take while overloaded or
+// shutting down.
+func BeaconHandler(c *fiber.Ctx) error {
+	if len(c.Body()) > maxBeaconBytes {
+		return c.SendStatus(fiber.StatusRequestEntityTooLarge)
+	}
+	var beacon Beacon
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	switch mediaType {
+	case fiber.MIMEApplicationForm, fiber.MIMEMultipartForm:
+		beacon.Token = c.FormValue("token")
+		beacon.Events = json.RawMessage(c.FormValue("events"))
+	default:
+		// text/plain, the type of a string beacon, is the only one sent without a CORS preflight
+		if err := json.Unmarshal(c.Body(), &beacon); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+	}
+
+	claims, err := auth.ParseToken(beacon.Token)
+	if err != nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	payloads, err := splitBatch(fiber.MIMEApplicationJSON, beacon.Events)
+	if err != nil {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if len(payloads) > maxBatchEvents {
+		return c.SendStatus(fiber.StatusRequestEntityTooLarge)
+	}
+	for _, payload := range payloads {
+		if err := Event(claims, payload, nil); err != nil {
+			log.Println("beacon event rejected:", claims.UserID, ErrorCode(err), err)
+			if errors.Is(err, events.ErrorOverloaded) || errors.Is(err, events.ErrorShuttingDown) {
+				deadLetterUnqueued(claims, payload, err)
+			}
+		}
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// deadLetterUnqueued dead-letters a valid event the pipeline couldn't queue,
+// with the actor of the token as the event would have been queued with
+func deadLetterUnqueued(claims *auth.Claims, payload []byte, reason error) {
+	var event events.EventMessage
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return // Event dead-lettered it already
+	}
+	event.SetActor(claims.UserID, claims.UserType, claims.OrgID)
+	events.DeadLetterEvent(event, reason)
+}
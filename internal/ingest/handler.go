@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-event-management/internal/auth"
+	"mime"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxBatchEvents bounds the events of a single request
+const maxBatchEvents = 1000
+
+// deliveryTimeout bounds how long a request with ack=delivered waits for the
+// sink, the sink is retried for as long as it is down
+var deliveryTimeout = 10 * time.Second
+
+// Statuses of an event of a batch
+const (
+	StatusAccepted  = "accepted"  // queued for batching
+	StatusDelivered = "delivered" // written to the sink, with ack=delivered
+	StatusRejected  = "rejected"
+)
+
+var (
+	ErrorEmptyBatch   = errors.New("ingest: no events in the body")
+	ErrorInvalidBatch = errors.New("ingest: body must be an event, a JSON array of events or NDJSON")
+)
+
+// EventResult is the outcome of an event of a batch, by its index in the body
+type EventResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchResult is the response of Handler
+type BatchResult struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []EventResult `json:"results"`
+}
+
+// Handler ingests the events of the body, a single EventMessage, a JSON array
+// of them or NDJSON with the application/x-ndjson content type. It needs
+// middleware.RequireToken in front of it. With the ack=delivered query param
+// it responds once every accepted event is written to the sink, or after
+// deliveryTimeout with the events not written yet reported as accepted.
+//
+// It responds 202 when every event is accepted (200 once all are delivered), 207 when
+// some are rejected, 503 when none is accepted and the pipeline is overloaded,
+// and 400 when none is accepted otherwise.
+func Handler(c *fiber.Ctx) error {
+	claims, _ := c.Locals("claims").(*auth.Claims)
+	payloads, err := splitBatch(c.Get(fiber.HeaderContentType), c.Body())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(payloads) > maxBatchEvents {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "a batch holds at most 1000 events"})
+	}
+
+	delivered := c.Query("ack") == StatusDelivered
+	results := make([]EventResult, len(payloads))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	waiting := true // results written once the handler stopped waiting are dropped
+	for index, payload := range payloads {
+		results[index].Index = index
+		var done func(error)
+		if delivered {
+			wg.Add(1)
+			done = func(err error) {
+				defer wg.Done()
+				mu.Lock()
+				defer mu.Unlock()
+				if !waiting {
+					return
+				}
+				if err != nil {
+					results[index] = EventResult{Index: index, Status: StatusRejected, Code: CodeDeliveryFailed, Error: err.Error()}
+					return
+				}
+				results[index].Status = StatusDelivered
+			}
+		}
+		if err := Event(claims, payload, done); err != nil {
+			if delivered {
+				wg.Done() // done is only called for queued events
+			}
+			mu.Lock()
+			results[index] = EventResult{Index: index, Status: StatusRejected, Code: ErrorCode(err), Error: err.Error()}
+			mu.Unlock()
+			continue
+		}
+		if !delivered {
+			results[index].Status = StatusAccepted
+		}
+	}
+	if delivered {
+		waitDelivery(c.Context(), &wg, deliveryTimeout)
+	}
+	mu.Lock()
+	waiting = false
+	mu.Unlock()
+
+	response := BatchResult{Results: results}
+	overloaded, pending := false, false
+	for index, result := range results {
+		switch result.Status {
+		case StatusRejected:
+			response.Rejected++
+			overloaded = overloaded || result.Code == CodeOverloaded
+			continue
+		case "":
+			// still on its way to the sink when the wait ran out
+			results[index].Status = StatusAccepted
+			pending = true
+		}
+		response.Accepted++
+	}
+	status := fiber.StatusAccepted
+	switch {
+	case response.Rejected == 0 && delivered && !pending:
+		status = fiber.StatusOK
+	case response.Rejected == 0:
+	case response.Accepted > 0:
+		status = fiber.StatusMultiStatus
+	case overloaded:
+		status = fiber.StatusServiceUnavailable
+	default:
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(response)
+}
+
+// waitDelivery waits for wg until timeout or until ctx is done
+func waitDelivery(ctx context.Context, wg *sync.WaitGroup, timeout time.Duration) {
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-finished:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// splitBatch returns the events of a body, the lines of NDJSON are returned
+// as they are so that a malformed line is rejected on its own
+func splitBatch(contentType string, body []byte) ([]json.RawMessage, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var payloads []json.RawMessage
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				payloads = append(payloads, line)
+			}
+		}
+	default:
+		body = bytes.TrimSpace(body)
+		switch {
+		case len(body) == 0:
+		case body[0] == '[':
+			if err := json.Unmarshal(body, &payloads); err != nil {
+				return nil, ErrorInvalidBatch
+			}
+		case body[0] == '{':
+			payloads = []json.RawMessage{body}
+		default:
+			return nil, ErrorInvalidBatch
+		}
+	}
+	if len(payloads) == 0 {
+		return nil, ErrorEmptyBatch
+	}
+	return payloads, nil
+}
@@ -0,0 +1,213 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"go-event-management/internal/auth"
+	"go-event-management/pkg/events"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// startPipeline runs the event pipeline against a memory sink
+func startPipeline() *events.MemorySink {
+	sink := events.NewMemorySink()
+	events.EventSink, events.EventLog, events.EventRoutes = sink, nil, nil
+	events.Batching = events.BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: 10 * time.Millisecond, Workers: 1, QueueSize: 100}
+	events.InitEvents()
+	return sink
+}
+
+func TestHandler(t *testing.T) {
+	sink := startPipeline()
+
+	app := fiber.New()
+	app.Post("/events", func(c *fiber.Ctx) error {
+		c.Locals("claims", &auth.Claims{UserID: "svc-1", UserType: "service"})
+		return c.Next()
+	}, Handler)
+
+	type testStruct struct {
+		contentType string
+		body        string
+		query       string
+		expCode     int
+		expStatuses string
+	}
+	var testCases = []testStruct{
+		{"application/json", `{"event_type":"page_view","user":"spoofed"}`, "", fiber.StatusAccepted, "accepted"},
+		{"application/json", `[{"event_type":"a"},{"event_type":"b"}]`, "ack=delivered", fiber.StatusOK, "delivered,delivered"},
+		{"application/x-ndjson", "{\"event_type\":\"a\"}\n\nnot json\r\n{\"event_type\":\"b\"}\n", "", fiber.StatusMultiStatus, "accepted,rejected,accepted"},
+		{"application/json", `[1]`, "", fiber.StatusBadRequest, "rejected"},
+		{"application/json", `[{"event_type":"a"}`, "", fiber.StatusBadRequest, ""},
+		{"application/json", `[]`, "", fiber.StatusBadRequest, ""},
+		{"application/json", `"event"`, "", fiber.StatusBadRequest, ""},
+		{"application/json", "[" + strings.Repeat(`{},`, maxBatchEvents) + "{}]", "", fiber.StatusRequestEntityTooLarge, ""},
+	}
+	for index, test := range testCases {
+		req := httptest.NewRequest("POST", "/events?"+test.query, strings.NewReader(test.body))
+		req.Header.Set(fiber.HeaderContentType, test.contentType)
+		resp, err := app.Test(req, 5000)
+		if err != nil {
+			t.Fatalf("Case %d: request Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if resp.StatusCode != test.expCode {
+			t.Errorf("Case %d: status code Error: (expected: %d, got: %d)", index+1, test.expCode, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result BatchResult
+		json.Unmarshal(body, &result)
+		statuses := make([]string, 0, len(result.Results))
+		for _, r := range result.Results {
+			statuses = append(statuses, r.Status)
+		}
+		if got := strings.Join(statuses, ","); got != test.expStatuses {
+			t.Errorf("Case %d: statuses Error: (expected: %s, got: %s)", index+1, test.expStatuses, got)
+		}
+	}
+
+	// the accepted events reach the sink, with the actor of the token
+	events.Shutdown(context.Background())
+	if count := len(sink.Messages()); count != 5 {
+		t.Errorf("sink messages Error: (expected: 5, got: %d)", count)
+	}
+	for _, message := range sink.Messages() {
+		var event events.EventMessage
+		json.Unmarshal(message.Value, &event)
+		if event.ActionBy != "svc-1" || event.User != "svc-1" {
+			t.Errorf("event actor Error: (expected: svc-1 svc-1, got: %s %s)", event.ActionBy, event.User)
+		}
+	}
+}
+
+// blockingSink holds writes until release is closed, like a sink that is down
+type blockingSink struct {
+	*events.MemorySink
+	release chan struct{}
+}
+
+func (s blockingSink) Write(ctx context.Context, batch []events.Message) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.MemorySink.Write(ctx, batch)
+}
+
+func TestHandlerDeliveryTimeout(t *testing.T) {
+	startPipeline()
+	sink := blockingSink{MemorySink: events.NewMemorySink(), release: make(chan struct{})}
+	events.EventSink = sink
+	defer func(timeout time.Duration) { deliveryTimeout = timeout }(deliveryTimeout)
+	deliveryTimeout = 50 * time.Millisecond
+
+	app := fiber.New()
+	app.Post("/events", func(c *fiber.Ctx) error {
+		c.Locals("claims", &auth.Claims{UserID: "svc-1", UserType: "service"})
+		return c.Next()
+	}, Handler)
+
+	req := httptest.NewRequest("POST", "/events?ack=delivered", strings.NewReader(`[{"event_type":"a"},1]`))
+	req.Header.Set(fiber.HeaderContentType, "application/json")
+	start := time.Now()
+	resp, err := app.Test(req, 5000)
+	if err != nil {
+		t.Fatalf("request Error: (expected: nil, got: %s)", err.Error())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("response time Error: (expected: < 1s, got: %s)", elapsed)
+	}
+	if resp.StatusCode != fiber.StatusMultiStatus {
+		t.Errorf("status code Error: (expected: %d, got: %d)", fiber.StatusMultiStatus, resp.StatusCode)
+	}
+	var result BatchResult
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, &result)
+	if len(result.Results) != 2 || result.Results[0].Status != StatusAccepted || result.Results[1].Status != StatusRejected {
+		t.Errorf("results Error: (expected: accepted,rejected, got: %s)", body)
+	}
+
+	// the event still reaches the sink once it is back, the late result is dropped
+	close(sink.release)
+	events.Shutdown(context.Background())
+	if count := len(sink.Messages()); count != 1 {
+		t.Errorf("sink messages Error: (expected: 1, got: %d)", count)
+	}
+}
+
+func TestBeaconHandler(t *testing.T) {
+	const secret = "beacon-test-secret"
+	if err := auth.Init(secret, ""); err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "user-1",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := startPipeline()
+	app := fiber.New()
+	app.Post("/events/beacon", BeaconHandler)
+
+	form := url.Values{"token": {token}, "events": {`{"event_type":"session_end"}`}}
+	type testStruct struct {
+		contentType string
+		body        string
+		expCode     int
+	}
+	var testCases = []testStruct{
+		{"text/plain;charset=UTF-8", `{"token":"` + token + `","events":[{"event_type":"screen_exit"},{"event_type":"session_end"}]}`, fiber.StatusNoContent},
+		{"application/x-www-form-urlencoded", form.Encode(), fiber.StatusNoContent},
+		{"text/plain;charset=UTF-8", `{"token":"not-a-token","events":[{"event_type":"screen_exit"}]}`, fiber.StatusUnauthorized},
+		{"text/plain;charset=UTF-8", `{"token":"` + token + `"}`, fiber.StatusBadRequest},
+		{"text/plain;charset=UTF-8", `not json`, fiber.StatusBadRequest},
+		{"text/plain;charset=UTF-8", strings.Repeat(" ", maxBeaconBytes+1), fiber.StatusRequestEntityTooLarge},
+	}
+	for index, test := range testCases {
+		req := httptest.NewRequest("POST", "/events/beacon", strings.NewReader(test.body))
+		req.Header.Set(fiber.HeaderContentType, test.contentType)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Case %d: request Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if resp.StatusCode != test.expCode {
+			t.Errorf("Case %d: status code Error: (expected: %d, got: %d)", index+1, test.expCode, resp.StatusCode)
+		}
+	}
+
+	events.Shutdown(context.Background())
+	if count := len(sink.Messages()); count != 3 {
+		t.Errorf("sink messages Error: (expected: 3, got: %d)", count)
+	}
+
+	// events beaconed while the pipeline shuts down are dead-lettered with the actor of the token
+	deadLetters := events.NewMemorySink()
+	events.DeadLetterSink = deadLetters
+	defer func() { events.DeadLetterSink = nil }()
+	req := httptest.NewRequest("POST", "/events/beacon", strings.NewReader(`{"token":"`+token+`","events":{"event_type":"screen_exit","action_by":"spoofed"}}`))
+	req.Header.Set(fiber.HeaderContentType, "text/plain;charset=UTF-8")
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("shutdown beacon Error: (expected: 204, got: %v %v)", resp, err)
+	}
+	letters := deadLetters.Messages()
+	if len(letters) != 1 {
+		t.Fatalf("dead letters Error: (expected: 1, got: %d)", len(letters))
+	}
+	var letter events.DeadLetter
+	var event events.EventMessage
+	json.Unmarshal(letters[0].Value, &letter)
+	json.Unmarshal([]byte(letter.Payload), &event)
+	if letter.Stage != events.StageQueue || event.ActionBy != "user-1" {
+		t.Errorf("dead letter Error: (expected: queue user-1, got: %s %s)", letter.Stage, event.ActionBy)
+	}
+}
@@ -0,0 +1,71 @@
+// Package ingest validates the events clients submit, enriches them with the
+// actor of the token and queues them on the event pipeline. It is shared by
+// the websocket and the HTTP endpoints.
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"go-event-management/internal/auth"
+	"go-event-management/internal/metrics"
+	"go-event-management/pkg/events"
+	"go-event-management/pkg/events/schema"
+)
+
+// Codes telling the client why an event was rejected
+const (
+	CodeInvalidJSON     = "invalid_json"
+	CodeSchemaViolation = "schema_violation"
+	CodeOverloaded      = "overloaded"
+	CodeDeliveryFailed  = "delivery_failed"
+	CodeInternal        = "internal_error"
+)
+
+// Error is returned for a rejected event
+type Error struct {
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Event queues the marshalled EventMessage on behalf of the token holder,
+// done is called once the sink confirms the write, see events.TrigerEvent.
+// Payloads that can't be queued are dead-lettered and an *Error is returned.
+func Event(claims *auth.Claims, payload []byte, done func(error)) error {
+	var event events.EventMessage
+	if err := json.Unmarshal(payload, &event); err != nil {
+		events.DeadLetterPayload(payload, err)
+		return &Error{Code: CodeInvalidJSON, Err: err}
+	}
+	metrics.MessagesReceived.WithLabelValues(metrics.EventTypeLabel(event.EventType)).Inc()
+	if err := schema.Validate(payload); err != nil {
+		events.DeadLetterPayload(payload, err)
+		return &Error{Code: CodeSchemaViolation, Err: err}
+	}
+	event.SetActor(claims.UserID, claims.UserType, claims.OrgID)
+
+	err := events.TrigerEvent(event, done)
+	if errors.Is(err, events.ErrorOverloaded) {
+		return &Error{Code: CodeOverloaded, Err: err}
+	}
+	if err != nil {
+		return &Error{Code: CodeInternal, Err: err}
+	}
+	return nil
+}
+
+// ErrorCode returns the code of an *Error, CodeInternal for any other error
+func ErrorCode(err error) string {
+	var ingestErr *Error
+	if errors.As(err, &ingestErr) {
+		return ingestErr.Code
+	}
+	return CodeInternal
+}
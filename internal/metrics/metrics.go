@@ -0,0 +1,159 @@
+// Package metrics declares the prometheus metrics of the service, they are
+// registered with the default registry and served by Handler
+package metrics
+
+import (
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "events"
+
+// Websocket metrics
+var (
+	WebsocketConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Websocket connections currently open.",
+	})
+	SSEStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sse_streams",
+		Help:      "Server-sent events streams of notifications currently open.",
+	})
+	WebsocketUpgrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_upgrades_total",
+		Help:      "Websocket upgrades by result: accepted, token_expired or token_invalid.",
+	}, []string{"result"})
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Events received from clients by event type.",
+	}, []string{"event_type"})
+	WebsocketReaped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_reaped_total",
+		Help:      "Websocket connections closed by the server by reason: pong_timeout, idle or rate_limited.",
+	}, []string{"reason"})
+	NotificationsPushed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_pushed_total",
+		Help:      "Notifications pushed to connections by status: delivered or failed.",
+	}, []string{"status"})
+	MessagesNacked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_nacked_total",
+		Help:      "Events rejected by nack code, invalid_json counts the payloads that couldn't be unmarshalled.",
+	}, []string{"code"})
+)
+
+// Notification consumer metrics
+var (
+	NotificationsConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_consumed_total",
+		Help:      "Kafka messages consumed by topic and result: delivered, undelivered, unmatched or invalid.",
+	}, []string{"topic", "result"})
+)
+
+// Pipeline metrics
+var (
+	BatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size_events",
+		Help:      "Events per flushed batch by route.",
+		Buckets:   []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	}, []string{"route"})
+	BatchFlushes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "batch_flushes_total",
+		Help:      "Flushed batches by route and reason: size, bytes, interval or shutdown.",
+	}, []string{"route", "reason"})
+	SinkWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sink_write_duration_seconds",
+		Help:      "Latency of batch writes to the sink of a route.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15), // 1ms to ~16s
+	}, []string{"route"})
+	SinkWriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_write_errors_total",
+		Help:      "Failed batch writes to the sink of a route, retries included.",
+	}, []string{"route"})
+	DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "Events dead-lettered by stage: validation, queue or delivery.",
+	}, []string{"stage"})
+)
+
+// Redis metrics
+var (
+	RedisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Latency of redis commands by instance (primary or replica) and command.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14), // 0.5ms to ~4s
+	}, []string{"instance", "command"})
+	RedisCommandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_command_errors_total",
+		Help:      "Failed redis commands by instance and command, misses excluded.",
+	}, []string{"instance", "command"})
+)
+
+// Handler serves the metrics in the prometheus text format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+var queueGauges sync.Once
+
+// QueueGauges reports the length and the capacity of the event queue, the
+// functions are read on every scrape. Only the first call registers them.
+func QueueGauges(length func() float64, capacity func() float64) {
+	queueGauges.Do(func() {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_length",
+			Help:      "Events waiting in the queue to be batched.",
+		}, length)
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_capacity",
+			Help:      "Events the queue holds before clients get overloaded nacks.",
+		}, capacity)
+	})
+}
+
+// maxEventTypes bounds the event_type label, the event type comes from clients
+const maxEventTypes = 200
+
+var eventTypes = struct {
+	sync.Mutex
+	seen map[string]struct{}
+}{seen: make(map[string]struct{})}
+
+// EventTypeLabel returns the label value for an event type, types seen after
+// the first maxEventTypes are counted as "other"
+func EventTypeLabel(eventType string) string {
+	if eventType == "" || len(eventType) > 64 {
+		return "other"
+	}
+	eventTypes.Lock()
+	defer eventTypes.Unlock()
+	if _, ok := eventTypes.seen[eventType]; ok {
+		return eventType
+	}
+	if len(eventTypes.seen) >= maxEventTypes {
+		return "other"
+	}
+	eventTypes.seen[eventType] = struct{}{}
+	return eventType
+}
@@ -0,0 +1,186 @@
+// Package notifications consumes kafka topics and delivers their messages to
+// the websocket clients picked by the delivery rules, so that backend services
+// notify clients by producing to kafka. Offsets are committed once a message
+// went through its delivery attempt, whether or not a client received it.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"go-event-management/internal/http/websocket"
+	"go-event-management/internal/metrics"
+	"log"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Results a consumed message is counted under
+const (
+	resultDelivered   = "delivered"   // reached at least one connection or instance
+	resultUndelivered = "undelivered" // nobody to deliver to
+	resultUnmatched   = "unmatched"   // no rule of the topic matched
+	resultInvalid     = "invalid"     // not a JSON object, or missing the target
+)
+
+const (
+	commitTimeout = 5 * time.Second
+	retryBackoff  = time.Second // wait after a failed fetch or commit
+)
+
+// Config sets up the consumer, see Start
+type Config struct {
+	Brokers []string
+	GroupID string
+	Rules   []Rule
+}
+
+var (
+	readers   []*kafka.Reader
+	consuming sync.WaitGroup
+	cancel    context.CancelFunc
+)
+
+// Start reads every topic named by the rules in the background, the rules of
+// a topic are tried in order. It needs to be called after the websocket
+// package is set up.
+func Start(cfg Config) error {
+	topics := map[string][]Rule{}
+	var order []string
+	for _, rule := range cfg.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if topics[rule.Topic] == nil {
+			order = append(order, rule.Topic)
+		}
+		topics[rule.Topic] = append(topics[rule.Topic], rule)
+	}
+
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	for _, topic := range order {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     cfg.Brokers,
+			GroupID:     cfg.GroupID,
+			Topic:       topic,
+			MaxWait:     time.Second,
+			StartOffset: kafka.LastOffset, // a new group skips the backlog, notifications go stale
+		})
+		readers = append(readers, reader)
+		consuming.Add(1)
+		go consume(ctx, reader, topics[topic])
+	}
+	return nil
+}
+
+// Shutdown stops fetching and closes the readers, the message being delivered
+// is committed first unless ctx is done before
+func Shutdown(ctx context.Context) error {
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		consuming.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for _, reader := range readers {
+		if err := reader.Close(); err != nil {
+			log.Println("notification reader close error:", err)
+		}
+	}
+	return nil
+}
+
+func consume(ctx context.Context, reader *kafka.Reader, rules []Rule) {
+	defer consuming.Done()
+	topic := reader.Config().Topic
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Println("notification fetch error:", topic, err)
+			wait(ctx, retryBackoff)
+			continue
+		}
+
+		result := handleMessage(msg.Value, rules)
+		metrics.NotificationsConsumed.WithLabelValues(topic, result).Inc()
+
+		// committed without ctx, so that a delivered message isn't read again after shutdown
+		for {
+			commitCtx, cancelCommit := context.WithTimeout(context.Background(), commitTimeout)
+			err := reader.CommitMessages(commitCtx, msg)
+			cancelCommit()
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+			log.Println("notification commit error:", topic, err)
+			wait(ctx, retryBackoff)
+		}
+	}
+}
+
+// handleMessage delivers a message through the first rule matching it and returns the result
+func handleMessage(message []byte, rules []Rule) string {
+	doc, err := decodeMessage(message)
+	if err != nil {
+		log.Println("notification decode error:", err)
+		return resultInvalid
+	}
+	for _, rule := range rules {
+		if !rule.matches(doc) {
+			continue
+		}
+		target, err := rule.target(doc)
+		if err != nil {
+			log.Println("notification rule error:", rule.Name, err)
+			return resultInvalid
+		}
+		payload, err := rule.payload(message, doc)
+		if err != nil {
+			log.Println("notification rule error:", rule.Name, err)
+			return resultInvalid
+		}
+		pushed, err := push(rule.Target, target, payload)
+		if err != nil {
+			log.Println("notification push error:", rule.Name, err)
+			return resultInvalid
+		}
+		if pushed.Delivered > 0 || pushed.RemoteInstances > 0 {
+			return resultDelivered
+		}
+		return resultUndelivered
+	}
+	return resultUnmatched
+}
+
+// push is replaced in tests
+var push = func(target string, to string, payload json.RawMessage) (websocket.PushResult, error) {
+	switch target {
+	case TargetUser:
+		return websocket.Push(to, payload)
+	case TargetChannel:
+		return websocket.Broadcast(to, payload)
+	}
+	return websocket.PushAll(payload)
+}
+
+func wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
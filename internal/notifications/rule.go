@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-event-management/pkg/events"
+	"path"
+)
+
+// Targets of a rule
+const (
+	TargetUser    = "user"    // the connections of a user
+	TargetChannel = "channel" // the subscribers of a channel
+	TargetAll     = "all"     // every connection
+)
+
+// Rule maps the messages of a topic it matches to the clients they are
+// delivered to. Match holds path.Match patterns keyed by dotted field paths,
+// a message matches when every field is a string matching its pattern.
+type Rule struct {
+	Name     string
+	Topic    string
+	Match    map[string]string
+	Target   string
+	Field    string // dotted path of the user id, or of the channel id
+	Channel  string // channel kind, the channel is <Channel>:<value at OrgField>:<value at Field>
+	OrgField string // dotted path of the organization id the channel belongs to
+	Payload  string // dotted path of the object pushed, the whole message when empty
+}
+
+// Validate checks the rule is usable
+func (r Rule) Validate() error {
+	if r.Name == "" || r.Topic == "" {
+		return fmt.Errorf("notifications: rule %q needs a name and a topic", r.Name)
+	}
+	switch r.Target {
+	case TargetUser:
+		if r.Field == "" {
+			return fmt.Errorf("notifications: rule %q has no user field", r.Name)
+		}
+	case TargetChannel:
+		if r.Field == "" || r.Channel == "" || r.OrgField == "" {
+			return fmt.Errorf("notifications: rule %q needs a channel, a field and an org field", r.Name)
+		}
+	case TargetAll:
+	default:
+		return fmt.Errorf("notifications: rule %q has an invalid target %q", r.Name, r.Target)
+	}
+	for field, pattern := range r.Match {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("notifications: rule %q has an invalid pattern %q for %s: %w", r.Name, pattern, field, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the decoded message matches every pattern of the rule
+func (r Rule) matches(doc map[string]interface{}) bool {
+	for field, pattern := range r.Match {
+		value, ok := events.LookupField(doc, field).(string)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// target returns the user id or the channel the message is delivered to, it
+// is empty for TargetAll
+func (r Rule) target(doc map[string]interface{}) (string, error) {
+	if r.Target == TargetAll {
+		return "", nil
+	}
+	id, err := idField(doc, r.Field)
+	if err != nil {
+		return "", err
+	}
+	if r.Target == TargetChannel {
+		org, err := idField(doc, r.OrgField)
+		if err != nil {
+			return "", err
+		}
+		return r.Channel + ":" + org + ":" + id, nil
+	}
+	return id, nil
+}
+
+// idField returns the id at the dotted path, ids are strings or numbers
+func idField(doc map[string]interface{}, field string) (string, error) {
+	var id string
+	switch value := events.LookupField(doc, field).(type) {
+	case string:
+		id = value
+	case json.Number:
+		id = value.String()
+	}
+	if id == "" {
+		return "", fmt.Errorf("notifications: message has no %s", field)
+	}
+	return id, nil
+}
+
+// payload returns the object pushed to the clients
+func (r Rule) payload(message []byte, doc map[string]interface{}) (json.RawMessage, error) {
+	if r.Payload == "" {
+		return message, nil
+	}
+	value, ok := events.LookupField(doc, r.Payload).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("notifications: message has no %s object", r.Payload)
+	}
+	return json.Marshal(value)
+}
+
+// decodeMessage decodes a message, numbers are kept as written so that ids don't lose digits
+func decodeMessage(message []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("notifications: message is not a JSON object")
+	}
+	return doc, nil
+}
@@ -0,0 +1,85 @@
+package notifications
+
+import (
+	"encoding/json"
+	"go-event-management/internal/http/websocket"
+	"testing"
+)
+
+func TestHandleMessage(t *testing.T) {
+	rules := []Rule{
+		{Name: "loan", Topic: "t", Match: map[string]string{"event_type": "loan_*"}, Target: TargetChannel,
+			Channel: "loan", OrgField: "organization_id", Field: "loan_application_id", Payload: "notification"},
+		{Name: "user", Topic: "t", Match: map[string]string{"kind": "user"}, Target: TargetUser, Field: "meta.user_id"},
+		{Name: "all", Topic: "t", Match: map[string]string{"kind": "announcement"}, Target: TargetAll},
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			t.Fatalf("Validate Error: (expected: nil, got: %s)", err.Error())
+		}
+	}
+
+	type pushed struct {
+		target  string
+		to      string
+		payload string
+	}
+	var got *pushed
+	delivered := 1
+	push = func(target string, to string, payload json.RawMessage) (websocket.PushResult, error) {
+		got = &pushed{target, to, string(payload)}
+		return websocket.PushResult{Delivered: delivered}, nil
+	}
+
+	type testStruct struct {
+		message   string
+		delivered int
+		expResult string
+		expPush   *pushed
+	}
+	var testCases = []testStruct{
+		{`{"event_type":"loan_approved","organization_id":"o-1","loan_application_id":"la-1","notification":{"status":"approved"}}`, 1,
+			resultDelivered, &pushed{TargetChannel, "loan:o-1:la-1", `{"status":"approved"}`}},
+		{`{"event_type":"loan_approved","loan_application_id":"la-1","notification":{"status":"approved"}}`, 1, resultInvalid, nil},
+		// numbers keep their digits
+		{`{"kind":"user","meta":{"user_id":12345678901234567890}}`, 0,
+			resultUndelivered, &pushed{TargetUser, "12345678901234567890", `{"kind":"user","meta":{"user_id":12345678901234567890}}`}},
+		{`{"kind":"announcement","text":"hi"}`, 2,
+			resultDelivered, &pushed{TargetAll, "", `{"kind":"announcement","text":"hi"}`}},
+		{`{"event_type":"audit"}`, 1, resultUnmatched, nil},
+		{`{"event_type":"loan_approved","notification":{}}`, 1, resultInvalid, nil},
+		{`{"event_type":"loan_approved","loan_application_id":"la-1","notification":"text"}`, 1, resultInvalid, nil},
+		{`[1,2]`, 1, resultInvalid, nil},
+		{`not json`, 1, resultInvalid, nil},
+	}
+	for index, test := range testCases {
+		got, delivered = nil, test.delivered
+		result := handleMessage([]byte(test.message), rules)
+		if result != test.expResult {
+			t.Errorf("Case %d: result Error: (expected: %s, got: %s)", index+1, test.expResult, result)
+		}
+		if (got == nil) != (test.expPush == nil) || (got != nil && *got != *test.expPush) {
+			t.Errorf("Case %d: push Error: (expected: %v, got: %v)", index+1, test.expPush, got)
+		}
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	type testStruct struct {
+		rule   Rule
+		expErr bool
+	}
+	var testCases = []testStruct{
+		{Rule{Name: "a", Topic: "t", Target: TargetAll}, false},
+		{Rule{Name: "a", Topic: "t", Target: TargetUser}, true},
+		{Rule{Name: "a", Topic: "t", Target: TargetChannel, Field: "id"}, true},
+		{Rule{Name: "a", Topic: "t", Target: "room"}, true},
+		{Rule{Name: "a", Target: TargetAll}, true},
+		{Rule{Name: "a", Topic: "t", Target: TargetAll, Match: map[string]string{"kind": "["}}, true},
+	}
+	for index, test := range testCases {
+		if err := test.rule.Validate(); (err != nil) != test.expErr {
+			t.Errorf("Case %d: Validate Error: (expected error: %t, got: %v)", index+1, test.expErr, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package presence
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserHandler responds whether the user of the :user param is online, with their connections
+func UserHandler(c *fiber.Ctx) error {
+	user := c.Params("user")
+	conns, err := UserConnections(c.Context(), user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"user":        user,
+		"online":      len(conns) > 0,
+		"connections": conns,
+	})
+}
+
+// UsersHandler lists the users online, filtered by the user_type or org_id query params
+func UsersHandler(c *fiber.Ctx) error {
+	users, err := OnlineUsers(c.Context(), requestFilter(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"users": users,
+		"count": len(users),
+	})
+}
+
+// CountHandler counts the users online, filtered by the user_type or org_id query params
+func CountHandler(c *fiber.Ctx) error {
+	count, err := CountOnline(c.Context(), requestFilter(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"count": count})
+}
+
+func requestFilter(c *fiber.Ctx) Filter {
+	return Filter{UserType: c.Query("user_type"), OrgID: c.Query("org_id")}
+}
@@ -0,0 +1,214 @@
+// Package presence tracks the websocket connections open across every
+// instance in redis. A connection is kept alive by heartbeats, one that
+// misses them for TTL counts as gone, so connections of an instance that
+// crashed drop off on their own.
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-event-management/internal/repository/redis"
+	"math"
+	"time"
+)
+
+const (
+	TTL               = 90 * time.Second // a connection without heartbeat for this long is offline
+	HeartbeatInterval = 30 * time.Second
+	heartbeatTimeout  = 5 * time.Second // bound of the refresh of a single connection
+)
+
+// Redis keys, the sorted sets are scored by the unix time the member was last seen at
+const (
+	connKeyPrefix     = "presence:conn:"      // connection record
+	userKeyPrefix     = "presence:user:"      // connection ids of a user
+	usersKey          = "presence:users"      // online users
+	userTypeKeyPrefix = "presence:user_type:" // online users of a user type
+	orgKeyPrefix      = "presence:org:"       // online users of an org
+)
+
+var ErrorInvalidConnection = errors.New("presence: connection id and user are required")
+
+// now is replaced in tests
+var now = time.Now
+
+// Connection is the presence record of a websocket connection
+type Connection struct {
+	ID          string    `json:"id"`
+	User        string    `json:"user"`
+	UserType    string    `json:"user_type"`
+	OrgID       string    `json:"org_id"`
+	Instance    string    `json:"instance"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// Filter narrows OnlineUsers and CountOnline down to a user type or an org,
+// with both set the user type wins
+type Filter struct {
+	UserType string
+	OrgID    string
+}
+
+func (f Filter) key() string {
+	if f.UserType != "" {
+		return userTypeKeyPrefix + f.UserType
+	}
+	if f.OrgID != "" {
+		return orgKeyPrefix + f.OrgID
+	}
+	return usersKey
+}
+
+// Connect records a connection as online
+func Connect(ctx context.Context, conn Connection) error {
+	if conn.ID == "" || conn.User == "" {
+		return ErrorInvalidConnection
+	}
+	if conn.ConnectedAt.IsZero() {
+		conn.ConnectedAt = now()
+	}
+	return redis.TxPipelined(ctx, func(pipe redis.Pipe) error {
+		return touch(pipe, conn)
+	})
+}
+
+// Heartbeat refreshes the connections of this instance, and drops the users
+// whose connections all stopped sending heartbeats. Every connection is
+// refreshed in one round trip bounded by heartbeatTimeout, so that a slow
+// refresh doesn't leave the connections after it to expire.
+func Heartbeat(ctx context.Context, conns []Connection) error {
+	var errs []error
+	cleaned := map[string]bool{}
+	for _, conn := range conns {
+		var keys []string
+		for _, key := range append(userSetKeys(conn), userKeyPrefix+conn.User) {
+			if !cleaned[key] {
+				keys = append(keys, key)
+			}
+		}
+		connCtx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+		err := redis.TxPipelined(connCtx, func(pipe redis.Pipe) error {
+			if err := touch(pipe, conn); err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if err := pipe.ZRemRangeByScore(key, math.Inf(-1), stale()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, key := range keys {
+			cleaned[key] = true
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Disconnect removes a connection, the user goes offline with their last connection
+func Disconnect(ctx context.Context, conn Connection) error {
+	if conn.ID == "" || conn.User == "" {
+		return ErrorInvalidConnection
+	}
+	if err := redis.ZRem(ctx, userKeyPrefix+conn.User, conn.ID); err != nil {
+		return err
+	}
+	if err := redis.Delete(ctx, connKeyPrefix+conn.ID); err != nil {
+		return err
+	}
+	// the primary is read, the replica may still list the connection just removed
+	left, err := redis.ZCountPrimary(ctx, userKeyPrefix+conn.User, stale(), math.Inf(1))
+	if err != nil || left > 0 {
+		return err
+	}
+	for _, key := range userSetKeys(conn) {
+		if err := redis.ZRem(ctx, key, conn.User); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsOnline tells whether the user has a connection open on any instance
+func IsOnline(ctx context.Context, user string) (bool, error) {
+	count, err := redis.ZCount(ctx, userKeyPrefix+user, stale(), math.Inf(1))
+	return count > 0, err
+}
+
+// UserConnections returns the open connections of a user
+func UserConnections(ctx context.Context, user string) ([]Connection, error) {
+	ids, err := redis.ZRangeByScore(ctx, userKeyPrefix+user, stale(), math.Inf(1))
+	if err != nil {
+		return nil, err
+	}
+	conns := make([]Connection, 0, len(ids))
+	for _, id := range ids {
+		value, err := redis.Get(ctx, connKeyPrefix+id)
+		if errors.Is(err, redis.Nil) {
+			continue // expired in between
+		}
+		if err != nil {
+			return nil, err
+		}
+		var conn Connection
+		if err := json.Unmarshal([]byte(value), &conn); err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// OnlineUsers returns the users online that match the filter
+func OnlineUsers(ctx context.Context, filter Filter) ([]string, error) {
+	return redis.ZRangeByScore(ctx, filter.key(), stale(), math.Inf(1))
+}
+
+// CountOnline returns the number of users online that match the filter
+func CountOnline(ctx context.Context, filter Filter) (int64, error) {
+	return redis.ZCount(ctx, filter.key(), stale(), math.Inf(1))
+}
+
+// touch queues the write of the connection record and marks the connection and
+// its user as seen now. Every key expires after TTL, so that the sets left
+// behind by a crashed instance or a user who never comes back don't stay forever.
+func touch(pipe redis.Pipe, conn Connection) error {
+	conn.LastSeen = now()
+	score := float64(conn.LastSeen.Unix())
+	if err := pipe.SetStruct(connKeyPrefix+conn.ID, conn, TTL); err != nil {
+		return err
+	}
+	if err := pipe.ZAddWithTTL(userKeyPrefix+conn.User, score, conn.ID, TTL); err != nil {
+		return err
+	}
+	for _, key := range userSetKeys(conn) {
+		if err := pipe.ZAddWithTTL(key, score, conn.User, TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userSetKeys returns the sorted sets the user of a connection is listed in
+func userSetKeys(conn Connection) []string {
+	keys := []string{usersKey}
+	if conn.UserType != "" {
+		keys = append(keys, userTypeKeyPrefix+conn.UserType)
+	}
+	if conn.OrgID != "" {
+		keys = append(keys, orgKeyPrefix+conn.OrgID)
+	}
+	return keys
+}
+
+// stale returns the score below which members missed their heartbeats
+func stale() float64 {
+	return float64(now().Add(-TTL).Unix())
+}
@@ -0,0 +1,131 @@
+package presence
+
+import (
+	"context"
+	"go-event-management/internal/repository/redis"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+var mr *miniredis.Miniredis
+
+func TestMain(m *testing.M) {
+	var err error
+	mr, err = miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	redis.Init(false, mr.Addr(), mr.Addr())
+	code := m.Run()
+	mr.Close()
+	os.Exit(code)
+}
+
+// setNow moves the clock of the package, and the ttl of the connection records with it
+func setNow(t time.Time) {
+	if elapsed := t.Sub(now()); elapsed > 0 {
+		mr.FastForward(elapsed)
+	}
+	now = func() time.Time { return t }
+}
+
+func TestPresence(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	setNow(start)
+
+	conns := []Connection{
+		{ID: "c1", User: "u1", UserType: "borrower", OrgID: "o1", Instance: "i1"},
+		{ID: "c2", User: "u1", UserType: "borrower", OrgID: "o1", Instance: "i2"},
+		{ID: "c3", User: "u2", UserType: "borrower", OrgID: "o2", Instance: "i1"},
+		{ID: "c4", User: "u3", UserType: "lender", OrgID: "o1", Instance: "i2"},
+	}
+	for _, conn := range conns {
+		if err := Connect(ctx, conn); err != nil {
+			t.Fatalf("Connect Error: (expected: nil, got: %s)", err.Error())
+		}
+	}
+	if err := Connect(ctx, Connection{ID: "c5"}); err != ErrorInvalidConnection {
+		t.Errorf("Connect Error: (expected: %v, got: %v)", ErrorInvalidConnection, err)
+	}
+
+	type testStruct struct {
+		filter   Filter
+		expUsers string
+	}
+	check := func(step string, testCases []testStruct) {
+		for index, test := range testCases {
+			users, err := OnlineUsers(ctx, test.filter)
+			if err != nil {
+				t.Fatalf("%s Case %d: OnlineUsers Error: (expected: nil, got: %s)", step, index+1, err.Error())
+			}
+			sort.Strings(users)
+			if got := strings.Join(users, ","); got != test.expUsers {
+				t.Errorf("%s Case %d: OnlineUsers Error: (expected: %s, got: %s)", step, index+1, test.expUsers, got)
+			}
+			count, err := CountOnline(ctx, test.filter)
+			if err != nil || int(count) != len(users) {
+				t.Errorf("%s Case %d: CountOnline Error: (expected: %d, got: %d %v)", step, index+1, len(users), count, err)
+			}
+		}
+	}
+	check("connected", []testStruct{
+		{Filter{}, "u1,u2,u3"},
+		{Filter{UserType: "borrower"}, "u1,u2"},
+		{Filter{OrgID: "o1"}, "u1,u3"},
+		{Filter{UserType: "admin"}, ""},
+	})
+
+	// u1 stays online while one of their connections is open
+	if err := Disconnect(ctx, conns[0]); err != nil {
+		t.Fatalf("Disconnect Error: (expected: nil, got: %s)", err.Error())
+	}
+	if online, _ := IsOnline(ctx, "u1"); !online {
+		t.Errorf("IsOnline Error: (expected: true, got: false)")
+	}
+	userConns, err := UserConnections(ctx, "u1")
+	if err != nil || len(userConns) != 1 || userConns[0].ID != "c2" || userConns[0].Instance != "i2" {
+		t.Errorf("UserConnections Error: (expected: c2 on i2, got: %v %v)", userConns, err)
+	}
+	if err := Disconnect(ctx, conns[1]); err != nil {
+		t.Fatalf("Disconnect Error: (expected: nil, got: %s)", err.Error())
+	}
+	if online, _ := IsOnline(ctx, "u1"); online {
+		t.Errorf("IsOnline Error: (expected: false, got: true)")
+	}
+	check("disconnected", []testStruct{
+		{Filter{}, "u2,u3"},
+		{Filter{UserType: "borrower"}, "u2"},
+		{Filter{OrgID: "o1"}, "u3"},
+	})
+
+	// u3 keeps sending heartbeats, the instance of u2 stopped
+	setNow(start.Add(TTL / 2))
+	if err := Heartbeat(ctx, []Connection{conns[3]}); err != nil {
+		t.Fatalf("Heartbeat Error: (expected: nil, got: %s)", err.Error())
+	}
+	setNow(start.Add(TTL + time.Second))
+	check("expired", []testStruct{
+		{Filter{}, "u3"},
+		{Filter{UserType: "borrower"}, ""},
+		{Filter{OrgID: "o2"}, ""},
+	})
+	if userConns, _ := UserConnections(ctx, "u2"); len(userConns) != 0 {
+		t.Errorf("UserConnections Error: (expected: none, got: %v)", userConns)
+	}
+
+	// the sets of u2 were left behind by its instance, they expire with their last member
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, userKeyPrefix+"u2") || strings.HasPrefix(key, orgKeyPrefix+"o2") {
+			t.Errorf("expired keys Error: (expected: no %s, got: it)", key)
+		}
+	}
+	if ttl, err := redis.GetTTL(ctx, userKeyPrefix+"u3"); err != nil || ttl <= 0 || ttl > TTL {
+		t.Errorf("key ttl Error: (expected: up to %s, got: %s %v)", TTL, ttl, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Package ratelimit keeps token buckets in redis, so that a limit holds across
+// every instance. Limits are set per user type, every user and every
+// connection of that type gets a bucket of its own.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"go-event-management/internal/repository/redis"
+	"time"
+)
+
+// DefaultUserType holds the limits of the user types that have none of their own
+const DefaultUserType = "default"
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst,
+// a zero Rate leaves the scope unlimited
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Limits of a user type, a message takes a token from both buckets
+type Limits struct {
+	User       Limit
+	Connection Limit
+}
+
+var limits map[string]Limits
+
+// now is replaced in tests
+var now = time.Now
+
+// bucketScript refills the buckets of KEYS for the time passed and takes a
+// token from each of them when they all have one. ARGV holds the current
+// time in ms, then the rate per second and the burst of every key. It returns
+// 0 when allowed, else the ms until a token is available in every bucket.
+var bucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local wait = 0
+local tokens = {}
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+	local state = redis.call('HMGET', key, 'tokens', 'ts')
+	local available = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	available = math.min(burst, available + math.max(0, now - ts) * rate / 1000)
+	if available < 1 then
+		wait = math.max(wait, math.ceil((1 - available) * 1000 / rate))
+	end
+	tokens[i] = available
+end
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+	if wait == 0 then
+		tokens[i] = tokens[i] - 1
+	end
+	redis.call('HMSET', key, 'tokens', tostring(tokens[i]), 'ts', now)
+	redis.call('PEXPIRE', key, math.ceil(burst * 1000 / rate) + 1000)
+end
+return wait
+`)
+
+// Init sets the limits by user type, DefaultUserType applies to the types
+// left out. Without limits Allow lets everything through.
+func Init(byUserType map[string]Limits) error {
+	for userType, l := range byUserType {
+		for _, limit := range []Limit{l.User, l.Connection} {
+			if limit.Rate < 0 || (limit.Rate > 0 && limit.Burst < 1) {
+				return fmt.Errorf("ratelimit: invalid limit of %s: rate %v, burst %d", userType, limit.Rate, limit.Burst)
+			}
+		}
+	}
+	limits = byUserType
+	return nil
+}
+
+// Enabled tells whether any limit is set
+func Enabled() bool {
+	return len(limits) > 0
+}
+
+// Allow takes a token from the buckets of the user and of the connection. It
+// returns 0 when the message is allowed, else how long to wait before the
+// next one is.
+func Allow(ctx context.Context, userType string, user string, conn string) (time.Duration, error) {
+	l, ok := limits[userType]
+	if !ok {
+		l = limits[DefaultUserType]
+	}
+	// the keys of a user share a hash slot, the script runs on a single node of a cluster
+	var keys []string
+	args := []interface{}{now().UnixMilli()}
+	if l.User.Rate > 0 {
+		keys = append(keys, "ratelimit:{"+user+"}:user")
+		args = append(args, l.User.Rate, l.User.Burst)
+	}
+	if l.Connection.Rate > 0 {
+		keys = append(keys, "ratelimit:{"+user+"}:conn:"+conn)
+		args = append(args, l.Connection.Rate, l.Connection.Burst)
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	result, err := bucketScript.Run(ctx, keys, args...)
+	if err != nil {
+		return 0, err
+	}
+	wait, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("ratelimit: unexpected script result %v", result)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
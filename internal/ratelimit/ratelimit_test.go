@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"go-event-management/internal/repository/redis"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMain(m *testing.M) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	redis.Init(false, mr.Addr(), mr.Addr())
+	code := m.Run()
+	mr.Close()
+	os.Exit(code)
+}
+
+func TestAllow(t *testing.T) {
+	ctx := context.Background()
+	err := Init(map[string]Limits{
+		DefaultUserType: {User: Limit{Rate: 10, Burst: 3}, Connection: Limit{Rate: 10, Burst: 2}},
+		"service":       {},
+	})
+	if err != nil {
+		t.Fatalf("Init Error: (expected: nil, got: %s)", err.Error())
+	}
+	start := time.Now()
+
+	type testStruct struct {
+		userType, user, conn string
+		elapsed              time.Duration // since start
+		expWait              time.Duration
+	}
+	var testCases = []testStruct{
+		// the connection bucket holds 2
+		{"lender", "u1", "c1", 0, 0},
+		{"lender", "u1", "c1", 0, 0},
+		{"lender", "u1", "c1", 0, 100 * time.Millisecond},
+		// the user bucket holds 3, across connections
+		{"lender", "u1", "c2", 0, 0},
+		{"lender", "u1", "c2", 0, 100 * time.Millisecond},
+		// other users have buckets of their own
+		{"borrower", "u2", "c3", 0, 0},
+		// a token is back after 100ms
+		{"lender", "u1", "c2", 100 * time.Millisecond, 0},
+		{"lender", "u1", "c2", 100 * time.Millisecond, 100 * time.Millisecond},
+		// user types without limits are let through
+		{"service", "u3", "c4", 0, 0},
+		{"service", "u3", "c4", 0, 0},
+		{"service", "u3", "c4", 0, 0},
+	}
+	for index, test := range testCases {
+		now = func() time.Time { return start.Add(test.elapsed) }
+		wait, err := Allow(ctx, test.userType, test.user, test.conn)
+		if err != nil {
+			t.Fatalf("Case %d: Allow Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if wait != test.expWait {
+			t.Errorf("Case %d: Allow Error: (expected: %s, got: %s)", index+1, test.expWait, wait)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	type testStruct struct {
+		limits Limits
+		expErr bool
+	}
+	var testCases = []testStruct{
+		{Limits{User: Limit{Rate: 1, Burst: 1}}, false},
+		{Limits{}, false},
+		{Limits{User: Limit{Rate: 1}}, true},
+		{Limits{Connection: Limit{Rate: -1, Burst: 1}}, true},
+	}
+	for index, test := range testCases {
+		err := Init(map[string]Limits{DefaultUserType: test.limits})
+		if (err != nil) != test.expErr {
+			t.Errorf("Case %d: Init Error: (expected error: %t, got: %v)", index+1, test.expErr, err)
+		}
+	}
+}
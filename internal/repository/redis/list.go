@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+// LPushCapped prepends the value to the list, keeps its newest size values
+// and sets its ttl, so that the list holds the recent history of something
+func LPushCapped(ctx context.Context, key string, value string, size int64, ttl time.Duration) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	key += suffix
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	pipe := rdb.TxPipeline()
+	pipe.LPush(ctx, key, value)
+	pipe.LTrim(ctx, key, 0, size-1)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LRange returns the values of the list between start and stop, inclusive,
+// negative indexes count from the end
+func LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	if key == "" {
+		return nil, ErrorEmptyKey
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdbReplica.LRange(ctx, key+suffix, start, stop).Result()
+}
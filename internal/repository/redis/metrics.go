@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"go-event-management/internal/metrics"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+type startKey struct{}
+
+// metricsHook records the latency and the errors of the commands of a client
+type metricsHook struct {
+	instance string // primary or replica
+}
+
+func (h metricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.observe(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+func (h metricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			err = cmdErr
+			break
+		}
+	}
+	h.observe(ctx, "pipeline", err)
+	return nil
+}
+
+func (h metricsHook) observe(ctx context.Context, command string, err error) {
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		metrics.RedisCommandDuration.WithLabelValues(h.instance, command).Observe(time.Since(start).Seconds())
+	}
+	if err != nil && err != redis.Nil {
+		metrics.RedisCommandErrors.WithLabelValues(h.instance, command).Inc()
+	}
+}
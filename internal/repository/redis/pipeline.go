@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// Pipe queues writes to the primary, they are sent in one round trip by TxPipelined
+type Pipe struct {
+	ctx  context.Context
+	pipe redis.Pipeliner
+}
+
+// TxPipelined runs the writes queued by fn in a transaction, in one round trip.
+// Nothing is sent when fn returns an error.
+func TxPipelined(ctx context.Context, fn func(pipe Pipe) error) error {
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	pipe := rdb.TxPipeline()
+	if err := fn(Pipe{ctx: ctx, pipe: pipe}); err != nil {
+		pipe.Discard()
+		return err
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// SetStruct queues a SetStruct
+func (p Pipe) SetStruct(key string, obj interface{}, ttl time.Duration) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	valueBytes, err := json.Marshal(obj)
+	if err != nil {
+		return ErrorUnsupportedValue
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	p.pipe.Set(p.ctx, key+suffix, string(valueBytes), ttl)
+	return nil
+}
+
+// ZAddWithTTL queues a ZAddWithTTL
+func (p Pipe) ZAddWithTTL(key string, score float64, member string, ttl time.Duration) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	key += suffix
+	p.pipe.ZAdd(p.ctx, key, &redis.Z{Score: score, Member: member})
+	p.pipe.Expire(p.ctx, key, ttl)
+	return nil
+}
+
+// ZRemRangeByScore queues a ZRemRangeByScore
+func (p Pipe) ZRemRangeByScore(key string, min float64, max float64) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	p.pipe.ZRemRangeByScore(p.ctx, key+suffix, formatScore(min), formatScore(max))
+	return nil
+}
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// Message is a message received on a subscribed channel
+type Message struct {
+	Channel string
+	Payload string
+}
+
+// Subscription receives the messages published on its channels. Channels can
+// be added and dropped while it is open, and they are subscribed to again
+// when the connection to redis is re-established.
+type Subscription struct {
+	pubsub   *redis.PubSub
+	messages chan Message
+}
+
+// Publish sends a message to a channel, it returns the number of subscribers
+// that received it, across all instances
+func Publish(ctx context.Context, channel string, message string) (int64, error) {
+	if channel == "" {
+		return 0, ErrorEmptyKey
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdb.Publish(ctx, channel+suffix, message).Result()
+}
+
+// Subscribe opens a subscription on the primary, it returns once redis
+// confirmed the channels. Channels can be left empty and added later.
+func Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	s := &Subscription{
+		pubsub:   rdb.Subscribe(ctx),
+		messages: make(chan Message, 100),
+	}
+	if err := s.Subscribe(ctx, channels...); err != nil {
+		s.pubsub.Close()
+		return nil, err
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	for range channels {
+		if _, err := s.pubsub.Receive(ctx); err != nil {
+			s.pubsub.Close()
+			return nil, err
+		}
+	}
+	go s.receive()
+	return s, nil
+}
+
+// Subscribe adds channels to the subscription, messages published before
+// redis processed it are not received
+func (s *Subscription) Subscribe(ctx context.Context, channels ...string) error {
+	if len(channels) == 0 {
+		return nil
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return s.pubsub.Subscribe(ctx, withSuffix(channels)...)
+}
+
+// Unsubscribe drops channels from the subscription
+func (s *Subscription) Unsubscribe(ctx context.Context, channels ...string) error {
+	if len(channels) == 0 {
+		return nil
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return s.pubsub.Unsubscribe(ctx, withSuffix(channels)...)
+}
+
+// Messages returns the channel messages are delivered on, it is closed with the subscription
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() error {
+	return s.pubsub.Close()
+}
+
+func (s *Subscription) receive() {
+	defer close(s.messages)
+	for msg := range s.pubsub.Channel() {
+		s.messages <- Message{Channel: strings.TrimSuffix(msg.Channel, suffix), Payload: msg.Payload}
+	}
+}
+
+func withSuffix(channels []string) []string {
+	result := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		result = append(result, channel+suffix)
+	}
+	return result
+}
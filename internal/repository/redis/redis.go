@@ -43,11 +43,41 @@ func Init(enableSSL bool, endpoint string, replicaEndpoint string) {
 	}
 	rdb = redistrace.NewClient(&options)
 	rdbReplica = redistrace.NewClient(&replicaOptions)
+	rdb.AddHook(metricsHook{instance: "primary"})
+	rdbReplica.AddHook(metricsHook{instance: "replica"})
+}
+
+// Close closes the rdb and rdbReplica clients, it is meant to be called on shutdown
+func Close() error {
+	err := rdb.Close()
+	if replicaErr := rdbReplica.Close(); err == nil {
+		err = replicaErr
+	}
+	return err
+}
+
+// Ping checks that the primary responds
+func Ping(ctx context.Context) error {
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdb.Ping(ctx).Err()
+}
+
+// PingReplica checks that the replica responds
+func PingReplica(ctx context.Context) error {
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdbReplica.Ping(ctx).Err()
 }
 
 // Set sets a string value with given ttl against a key
 // 0 ttl means no expiry
 func Set(key string, value string, ttl time.Duration) error {
+	return SetWithContext(context.Background(), key, value, ttl)
+}
+
+// SetWithContext sets like Set, giving up once ctx is done
+func SetWithContext(ctx context.Context, key string, value string, ttl time.Duration) error {
 	if ttl < 0 {
 		ttl = 0
 	}
@@ -55,11 +85,9 @@ func Set(key string, value string, ttl time.Duration) error {
 		return ErrorEmptyKey
 	}
 	key += suffix
-	err := rdb.Set(context.Background(), key, value, ttl)
-	if err != nil {
-		return err.Err()
-	}
-	return nil
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdb.Set(ctx, key, value, ttl).Err()
 }
 
 // Keys returns all keys matching with pattern
@@ -92,11 +120,16 @@ func GetTTL(ctx context.Context, key string) (time.Duration, error) {
 
 // SetStruct sets a struct object with given ttl against a key
 func SetStruct(key string, obj interface{}, ttl time.Duration) error {
+	return SetStructWithContext(context.Background(), key, obj, ttl)
+}
+
+// SetStructWithContext sets like SetStruct, giving up once ctx is done
+func SetStructWithContext(ctx context.Context, key string, obj interface{}, ttl time.Duration) error {
 	valueBytes, err := json.Marshal(obj)
 	if err != nil {
 		return ErrorUnsupportedValue
 	}
-	return Set(key, string(valueBytes), ttl)
+	return SetWithContext(ctx, key, string(valueBytes), ttl)
 }
 
 // SetStructWithLongTTL sets a struct object with a predefined long ttl value
@@ -8,7 +8,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/alicebob/miniredis"
+	"github.com/alicebob/miniredis/v2"
 	redis "github.com/go-redis/redis/v8"
 )
 
@@ -378,3 +378,119 @@ func TestSetGetLongTTLStruct(t *testing.T) {
 		}
 	}
 }
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	if err := Ping(ctx); err != nil {
+		t.Errorf("Ping Error: (expected: nil, got: %s)", err.Error())
+	}
+	if err := PingReplica(ctx); err != nil {
+		t.Errorf("PingReplica Error: (expected: nil, got: %s)", err.Error())
+	}
+	mr.Close()
+	defer mr.Restart()
+	if err := Ping(ctx); err == nil {
+		t.Errorf("Ping Error: (expected: connection error, got: nil)")
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	ctx := context.Background()
+	sub, err := Subscribe(ctx, "channel1")
+	if err != nil {
+		t.Fatalf("Subscribe Error: (expected: nil, got: %s)", err.Error())
+	}
+	defer sub.Close()
+	if err := sub.Subscribe(ctx, "channel2"); err != nil {
+		t.Fatalf("Subscribe Error: (expected: nil, got: %s)", err.Error())
+	}
+	// channels added later are confirmed asynchronously
+	time.Sleep(50 * time.Millisecond)
+
+	type testStruct struct {
+		channel, message string
+		receivers        int64
+		pubError         *error
+	}
+	var testCases = []testStruct{
+		{"channel1", "message1", 1, nil},
+		{"channel2", "message2", 1, nil},
+		{"channel3", "message3", 0, nil}, // nobody subscribed
+		{"", "message4", 0, &ErrorEmptyKey},
+	}
+	for index, test := range testCases {
+		receivers, err := Publish(ctx, test.channel, test.message)
+		if test.pubError != nil {
+			if err != *test.pubError {
+				t.Errorf("Case %d: Publish Error: (expected: %v, got: %v)", index+1, *test.pubError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Case %d: Publish Error: (expected: nil, got: %s)", index+1, err.Error())
+			continue
+		}
+		if receivers != test.receivers {
+			t.Errorf("Case %d: Publish receivers Error: (expected: %d, got: %d)", index+1, test.receivers, receivers)
+		}
+		if receivers == 0 {
+			continue
+		}
+		select {
+		case msg := <-sub.Messages():
+			if msg.Channel != test.channel || msg.Payload != test.message {
+				t.Errorf("Case %d: Message Error: (expected: %s %s, got: %s %s)", index+1, test.channel, test.message, msg.Channel, msg.Payload)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Case %d: Message Error: (expected: %s, got: nothing)", index+1, test.message)
+		}
+	}
+
+	if err := sub.Unsubscribe(ctx, "channel1"); err != nil {
+		t.Fatalf("Unsubscribe Error: (expected: nil, got: %s)", err.Error())
+	}
+	time.Sleep(50 * time.Millisecond)
+	if receivers, _ := Publish(ctx, "channel1", "message5"); receivers != 0 {
+		t.Errorf("Publish after Unsubscribe Error: (expected: 0 receivers, got: %d)", receivers)
+	}
+}
+
+func TestTxPipelined(t *testing.T) {
+	ctx := context.Background()
+	type testStruct struct {
+		record  string
+		set     string
+		expErr  error
+		expKeys bool // whether the writes were sent
+	}
+	var testCases = []testStruct{
+		{"pipe:record1", "pipe:set1", nil, true},
+		{"pipe:record2", "", ErrorEmptyKey, false},
+		{"", "pipe:set3", ErrorEmptyKey, false},
+	}
+	for index, test := range testCases {
+		err := TxPipelined(ctx, func(pipe Pipe) error {
+			if err := pipe.ZAddWithTTL(test.set, 1, "m1", time.Minute); err != nil {
+				return err
+			}
+			return pipe.SetStruct(test.record, dummyStruct{RandomKey1: "key_1"}, time.Minute)
+		})
+		if err != test.expErr {
+			t.Errorf("Case %d: TxPipelined Error: (expected: %v, got: %v)", index+1, test.expErr, err)
+		}
+		// nothing is sent when a write can't be queued
+		for _, key := range []string{test.record, test.set} {
+			if key == "" {
+				continue
+			}
+			if exists := mr.Exists(key + suffix); exists != test.expKeys {
+				t.Errorf("Case %d: %s Error: (expected: %t, got: %t)", index+1, key, test.expKeys, exists)
+			}
+			if test.expKeys {
+				if ttl, _ := GetTTL(ctx, key); ttl != time.Minute {
+					t.Errorf("Case %d: %s TTL Error: (expected: %s, got: %s)", index+1, key, time.Minute, ttl)
+				}
+			}
+		}
+	}
+}
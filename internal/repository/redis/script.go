@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"context"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// Script is a lua script run on the primary, it is loaded once and called by
+// its sha afterwards
+type Script struct {
+	script *redis.Script
+}
+
+func NewScript(src string) *Script {
+	return &Script{script: redis.NewScript(src)}
+}
+
+// Run runs the script against the given keys. In a cluster the keys of a call
+// need to share a hash slot, e.g. through a {hash tag}.
+func (s *Script) Run(ctx context.Context, keys []string, args ...interface{}) (interface{}, error) {
+	for _, key := range keys {
+		if key == "" {
+			return nil, ErrorEmptyKey
+		}
+	}
+	suffixed := make([]string, len(keys))
+	for i, key := range keys {
+		suffixed[i] = key + suffix
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return s.script.Run(ctx, rdb, suffixed, args...).Result()
+}
@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// ZAdd adds the member to the sorted set with the given score, updating the
+// score of a member that is already in it
+func ZAdd(ctx context.Context, key string, score float64, member string) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdb.ZAdd(ctx, key+suffix, &redis.Z{Score: score, Member: member}).Err()
+}
+
+// ZAddWithTTL adds the member like ZAdd and sets the ttl of the sorted set, so
+// that a set nobody adds to anymore expires
+func ZAddWithTTL(ctx context.Context, key string, score float64, member string, ttl time.Duration) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	key += suffix
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	pipe := rdb.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: score, Member: member})
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ZRem removes members from the sorted set
+// It does not return an error if a member is not found
+func ZRem(ctx context.Context, key string, members ...string) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(members))
+	for _, member := range members {
+		args = append(args, member)
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdb.ZRem(ctx, key+suffix, args...).Err()
+}
+
+// ZRangeByScore returns the members of the sorted set scored between min and
+// max, inclusive, by ascending score
+func ZRangeByScore(ctx context.Context, key string, min float64, max float64) ([]string, error) {
+	if key == "" {
+		return []string{}, ErrorEmptyKey
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdbReplica.ZRangeByScore(ctx, key+suffix, &redis.ZRangeBy{
+		Min: formatScore(min),
+		Max: formatScore(max),
+	}).Result()
+}
+
+// ZCount returns the number of members of the sorted set scored between min and max, inclusive
+func ZCount(ctx context.Context, key string, min float64, max float64) (int64, error) {
+	if key == "" {
+		return 0, ErrorEmptyKey
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdbReplica.ZCount(ctx, key+suffix, formatScore(min), formatScore(max)).Result()
+}
+
+// ZCountPrimary counts like ZCount on the primary, for reads that need to see
+// the writes just made
+func ZCountPrimary(ctx context.Context, key string, min float64, max float64) (int64, error) {
+	if key == "" {
+		return 0, ErrorEmptyKey
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdb.ZCount(ctx, key+suffix, formatScore(min), formatScore(max)).Result()
+}
+
+// ZRemRangeByScore removes the members of the sorted set scored between min and max, inclusive
+func ZRemRangeByScore(ctx context.Context, key string, min float64, max float64) error {
+	if key == "" {
+		return ErrorEmptyKey
+	}
+	ctx, cancelCtx := context.WithTimeout(ctx, contextTimeout)
+	defer cancelCtx()
+	return rdb.ZRemRangeByScore(ctx, key+suffix, formatScore(min), formatScore(max)).Err()
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
@@ -0,0 +1,223 @@
+// Package rpc serves the gRPC event ingestion API of pkg/events/eventspb, it
+// feeds the event pipeline through the same validation as the websocket
+package rpc
+
+import (
+	"context"
+	"errors"
+	"go-event-management/internal/auth"
+	"go-event-management/internal/ingest"
+	"go-event-management/pkg/events"
+	"go-event-management/pkg/events/eventspb"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// codeInvalidRequest rejects a request without event, or a stream request without id
+const codeInvalidRequest = "invalid_request"
+
+// eventJSON marshals events with the field names of events.EventMessage
+var eventJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+var server *grpc.Server
+
+// Serve listens on addr and serves the event service with reflection in the
+// background, it returns once the listener is open
+func Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server = newServer()
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Println("grpc server error:", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops accepting calls and waits for the running ones, those still
+// running when ctx is done are cancelled
+func Shutdown(ctx context.Context) error {
+	if server == nil {
+		return nil
+	}
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
+
+func newServer() *grpc.Server {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(unaryAuth), grpc.ChainStreamInterceptor(streamAuth))
+	eventspb.RegisterEventServiceServer(s, eventServer{})
+	reflection.Register(s)
+	return s
+}
+
+type eventServer struct {
+	eventspb.UnimplementedEventServiceServer
+}
+
+func (eventServer) Publish(ctx context.Context, req *eventspb.PublishRequest) (*eventspb.PublishResponse, error) {
+	var delivered chan error
+	var done func(error)
+	if req.WaitForDelivery {
+		delivered = make(chan error, 1)
+		done = func(err error) { delivered <- err }
+	}
+	if err := publish(claimsFromContext(ctx), req, done); err != nil {
+		return nil, status.Error(grpcCode(err), err.Error())
+	}
+	if delivered == nil {
+		return &eventspb.PublishResponse{Id: req.Id, Status: eventspb.Status_STATUS_ACCEPTED}, nil
+	}
+	select {
+	case err := <-delivered:
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return &eventspb.PublishResponse{Id: req.Id, Status: eventspb.Status_STATUS_DELIVERED}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (eventServer) PublishStream(stream eventspb.EventService_PublishStreamServer) error {
+	claims := claimsFromContext(stream.Context())
+	// responses of delivered events are sent from the pipeline, next to the read
+	// loop. Once the handler returns the stream can't be sent on, so the
+	// responses of events delivered after that are dropped.
+	var sendMu sync.Mutex
+	closed := false
+	send := func(resp *eventspb.PublishResponse) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		if closed {
+			return
+		}
+		if err := stream.Send(resp); err != nil {
+			log.Println("grpc stream send error:", err)
+		}
+	}
+	var pending sync.WaitGroup
+	defer func() {
+		waitPending(stream.Context(), &pending)
+		sendMu.Lock()
+		closed = true
+		sendMu.Unlock()
+	}()
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Id == "" {
+			send(&eventspb.PublishResponse{Status: eventspb.Status_STATUS_REJECTED, Code: codeInvalidRequest, Error: "id is required"})
+			continue
+		}
+
+		id := req.Id
+		var done func(error)
+		if req.WaitForDelivery {
+			pending.Add(1)
+			done = func(err error) {
+				defer pending.Done()
+				if err != nil {
+					send(&eventspb.PublishResponse{Id: id, Status: eventspb.Status_STATUS_REJECTED, Code: ingest.CodeDeliveryFailed, Error: err.Error()})
+					return
+				}
+				send(&eventspb.PublishResponse{Id: id, Status: eventspb.Status_STATUS_DELIVERED})
+			}
+		}
+		if err := publish(claims, req, done); err != nil {
+			if done != nil {
+				pending.Done() // done is only called for queued events
+			}
+			send(&eventspb.PublishResponse{Id: id, Status: eventspb.Status_STATUS_REJECTED, Code: errorCode(err), Error: err.Error()})
+			continue
+		}
+		if done == nil {
+			send(&eventspb.PublishResponse{Id: id, Status: eventspb.Status_STATUS_ACCEPTED})
+		}
+	}
+}
+
+// waitPending waits for the responses of the delivered events of a stream
+// until the client cancels it or goes away
+func waitPending(ctx context.Context, pending *sync.WaitGroup) {
+	finished := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+	}
+}
+
+// requestError rejects a malformed request
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// publish hands the event of the request to ingest as the JSON an EventMessage marshals to
+func publish(claims *auth.Claims, req *eventspb.PublishRequest, done func(error)) error {
+	if req.Event == nil {
+		return &requestError{message: "event is required"}
+	}
+	payload, err := eventJSON.Marshal(req.Event)
+	if err != nil {
+		return err
+	}
+	return ingest.Event(claims, payload, done)
+}
+
+// errorCode returns the rejection code of a publish error
+func errorCode(err error) string {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return codeInvalidRequest
+	}
+	return ingest.ErrorCode(err)
+}
+
+// grpcCode returns the status code a publish error is reported with
+func grpcCode(err error) codes.Code {
+	switch errorCode(err) {
+	case codeInvalidRequest, ingest.CodeInvalidJSON, ingest.CodeSchemaViolation:
+		return codes.InvalidArgument
+	case ingest.CodeOverloaded:
+		return codes.ResourceExhausted
+	}
+	if errors.Is(err, events.ErrorShuttingDown) {
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"go-event-management/internal/auth"
+	"go-event-management/pkg/events"
+	"go-event-management/pkg/events/eventspb"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const secret = "rpc-test-secret"
+
+// startServer serves the event service over an in-memory listener, in front of a pipeline writing to a memory sink
+func startServer(t *testing.T) (eventspb.EventServiceClient, *events.MemorySink) {
+	if err := auth.Init(secret, ""); err != nil {
+		t.Fatal(err)
+	}
+	sink := events.NewMemorySink()
+	events.EventSink, events.EventLog, events.EventRoutes = sink, nil, nil
+	events.Batching = events.BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: 10 * time.Millisecond, Workers: 1, QueueSize: 100}
+	events.InitEvents()
+
+	lis := bufconn.Listen(1 << 20)
+	server = newServer()
+	s := server
+	go s.Serve(lis)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+		events.Shutdown(context.Background())
+	})
+	return eventspb.NewEventServiceClient(conn), sink
+}
+
+func withToken(t *testing.T, ctx context.Context) context.Context {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":   "svc-1",
+		"user_type": "service",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestPublish(t *testing.T) {
+	client, _ := startServer(t)
+	authorized := withToken(t, context.Background())
+
+	type testStruct struct {
+		ctx       context.Context
+		req       *eventspb.PublishRequest
+		expCode   codes.Code
+		expStatus eventspb.Status
+	}
+	event := &eventspb.EventMessage{EventType: "loan_status_change", LoanMetaData: &eventspb.LoanMetaData{LoanApplicationId: "la-1"}}
+	var testCases = []testStruct{
+		{authorized, &eventspb.PublishRequest{Id: "1", Event: event}, codes.OK, eventspb.Status_STATUS_ACCEPTED},
+		{authorized, &eventspb.PublishRequest{Id: "2", Event: event, WaitForDelivery: true}, codes.OK, eventspb.Status_STATUS_DELIVERED},
+		{authorized, &eventspb.PublishRequest{Id: "3"}, codes.InvalidArgument, eventspb.Status_STATUS_UNSPECIFIED},
+		{context.Background(), &eventspb.PublishRequest{Id: "4", Event: event}, codes.Unauthenticated, eventspb.Status_STATUS_UNSPECIFIED},
+	}
+	for index, test := range testCases {
+		resp, err := client.Publish(test.ctx, test.req)
+		if code := status.Code(err); code != test.expCode {
+			t.Errorf("Case %d: Publish Error: (expected: %s, got: %s)", index+1, test.expCode, code)
+		}
+		if resp.GetStatus() != test.expStatus {
+			t.Errorf("Case %d: Publish Error: (expected: %s, got: %s)", index+1, test.expStatus, resp.GetStatus())
+		}
+	}
+}
+
+func TestPublishStream(t *testing.T) {
+	client, sink := startServer(t)
+	stream, err := client.PublishStream(withToken(t, context.Background()))
+	if err != nil {
+		t.Fatalf("PublishStream Error: (expected: nil, got: %s)", err.Error())
+	}
+	event := &eventspb.EventMessage{EventType: "page_view", User: "spoofed", ActionBy: "spoofed"}
+	requests := []*eventspb.PublishRequest{
+		{Id: "1", Event: event},
+		{Id: "2", Event: event, WaitForDelivery: true},
+		{Id: "3"},
+		{Event: event},
+	}
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("Send Error: (expected: nil, got: %s)", err.Error())
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend Error: (expected: nil, got: %s)", err.Error())
+	}
+
+	expected := map[string]eventspb.Status{
+		"1": eventspb.Status_STATUS_ACCEPTED,
+		"2": eventspb.Status_STATUS_DELIVERED,
+		"3": eventspb.Status_STATUS_REJECTED,
+		"":  eventspb.Status_STATUS_REJECTED,
+	}
+	for range requests {
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv Error: (expected: nil, got: %s)", err.Error())
+		}
+		if resp.Status != expected[resp.Id] {
+			t.Errorf("response %q Error: (expected: %s, got: %s)", resp.Id, expected[resp.Id], resp.Status)
+		}
+	}
+
+	// the actor comes from the token
+	events.Shutdown(context.Background())
+	messages := sink.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("sink messages Error: (expected: 2, got: %d)", len(messages))
+	}
+	var written events.EventMessage
+	if err := json.Unmarshal(messages[0].Value, &written); err != nil || written.ActionBy != "svc-1" || written.User != "svc-1" {
+		t.Errorf("event actor Error: (expected: svc-1 svc-1, got: %s %s %v)", written.ActionBy, written.User, err)
+	}
+	if key := string(messages[0].Key); key != "svc-1" {
+		t.Errorf("partition key Error: (expected: svc-1, got: %s)", key)
+	}
+}
+
+// blockingSink holds writes until release is closed, like a sink that is down
+type blockingSink struct {
+	*events.MemorySink
+	release chan struct{}
+}
+
+func (s blockingSink) Write(ctx context.Context, batch []events.Message) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.MemorySink.Write(ctx, batch)
+}
+
+func TestPublishStreamCancel(t *testing.T) {
+	client, _ := startServer(t)
+	sink := blockingSink{MemorySink: events.NewMemorySink(), release: make(chan struct{})}
+	events.EventSink = sink
+	t.Cleanup(func() { close(sink.release) })
+
+	ctx, cancel := context.WithCancel(withToken(t, context.Background()))
+	stream, err := client.PublishStream(ctx)
+	if err != nil {
+		t.Fatalf("PublishStream Error: (expected: nil, got: %s)", err.Error())
+	}
+	event := &eventspb.EventMessage{EventType: "page_view"}
+	if err := stream.Send(&eventspb.PublishRequest{Id: "1", Event: event, WaitForDelivery: true}); err != nil {
+		t.Fatalf("Send Error: (expected: nil, got: %s)", err.Error())
+	}
+	time.Sleep(50 * time.Millisecond) // the event is waiting on the sink
+	cancel()
+
+	// the handler stops waiting for the delivery, so the server stops gracefully
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShutdown()
+	if err := Shutdown(shutdownCtx); err != nil {
+		t.Errorf("Shutdown Error: (expected: nil, got: %s)", err.Error())
+	}
+}
@@ -1,28 +1,55 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"go-event-management/conf"
+	"go-event-management/internal/auth"
+	"go-event-management/internal/http/health"
+	"go-event-management/internal/http/middleware"
 	internalWebsocket "go-event-management/internal/http/websocket"
+	"go-event-management/internal/ingest"
+	"go-event-management/internal/metrics"
+	"go-event-management/internal/notifications"
+	"go-event-management/internal/presence"
+	"go-event-management/internal/ratelimit"
 	"go-event-management/internal/repository/redis"
+	"go-event-management/internal/rpc"
 	"go-event-management/pkg/events"
+	"go-event-management/pkg/events/schema"
+	"go-event-management/pkg/events/wal"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
-	kafka "github.com/segmentio/kafka-go"
 )
 
 func main() {
 
-	startWebsocketServer()
+	addr := flag.String("addr", ":3335", "http service address")
+	redrive := flag.String("redrive", "", "re-drive the dead letters of the given NDJSON file, or of the kafka topic given as "+
+		redriveKafkaScheme+"<topic>, through the event pipeline and exit. "+redriveKafkaScheme+" alone reads the configured dead letter topic")
+	flag.Parse()
 
-}
+	if *redrive != "" {
+		redriveDeadLetters(*redrive)
+		return
+	}
+
+	startWebsocketServer(*addr)
 
-func startWebsocketServer() {
-	defer close(events.Done)
+}
 
+func startWebsocketServer(addr string) {
 	app := fiber.New()
 
 	//TODO: move expiration and max cconnection count in constants
@@ -38,22 +65,357 @@ func startWebsocketServer() {
 
 	redis.Init(enableSSL, endpoint, replicaEndpoint)
 
-	go events.InitEvents()
-	topic := "quickstart-events"
-	events.KafkaConn = &kafka.Writer{
-		// TODO: Add server urls in Config/constants
+	// init auth, the jwks file is optional when only hmac tokens are issued
+	hmacSecret, _ := conf.AuthConf["HMACSecret"].(string)
+	jwksPath, _ := conf.AuthConf["JWKSPath"].(string)
+	if _, err := os.Stat(jwksPath); errors.Is(err, fs.ErrNotExist) {
+		jwksPath = ""
+	}
+	if err := auth.Init(hmacSecret, jwksPath); err != nil {
+		log.Fatalln("couldn't init auth:", err)
+	}
 
-		Addr:     kafka.TCP("localhost:9092"),
-		Topic:    topic,
-		Balancer: &kafka.LeastBytes{},
+	initEventPipeline()
+	openEventLog()
+	events.InitEvents()
+
+	ackMode, _ := conf.WebsocketConf["AckMode"].(string)
+	channelUserTypes, _ := conf.WebsocketConf["ChannelUserTypes"].(map[string][]string)
+	channelAnyOrgUserTypes, _ := conf.WebsocketConf["ChannelAnyOrgUserTypes"].([]string)
+	pingInterval, _ := conf.WebsocketConf["PingInterval"].(time.Duration)
+	pongTimeout, _ := conf.WebsocketConf["PongTimeout"].(time.Duration)
+	idleTimeout, _ := conf.WebsocketConf["IdleTimeout"].(time.Duration)
+	throttleCloseAfter, _ := conf.WebsocketConf["ThrottleCloseAfter"].(int)
+	notificationHistory, _ := conf.WebsocketConf["NotificationHistory"].(int)
+	internalWebsocket.Init(internalWebsocket.Config{
+		AckMode:                ackMode,
+		ChannelUserTypes:       channelUserTypes,
+		ChannelAnyOrgUserTypes: channelAnyOrgUserTypes,
+		PingInterval:           pingInterval,
+		PongTimeout:            pongTimeout,
+		IdleTimeout:            idleTimeout,
+		ThrottleCloseAfter:     throttleCloseAfter,
+		NotificationHistory:    notificationHistory,
+	})
+	initRateLimits()
+	if relay, _ := conf.WebsocketConf["PushRelay"].(bool); relay {
+		if err := internalWebsocket.StartRelay(context.Background()); err != nil {
+			log.Fatalln("couldn't start notification relay:", err)
+		}
+	}
+	if tracked, _ := conf.WebsocketConf["Presence"].(bool); tracked {
+		internalWebsocket.StartPresence()
 	}
+	if consumer, _ := conf.NotificationsConf["Consumer"].(bool); consumer {
+		startNotificationConsumer()
+	}
+
+	// probes, readiness fails as soon as the server starts shutting down
+	health.Register("websocket", internalWebsocket.CheckAccepting)
+	health.Register("redis_primary", redis.Ping)
+	health.Register("redis_replica", redis.PingReplica)
+	health.Register("sinks", events.CheckSinks)
+	health.Register("batcher", events.CheckPipeline)
+	app.Get("/healthz", health.Healthz)
+	app.Get("/readyz", health.Readyz)
+
+	// notifications pushed by backend services to the connections of a user
+	pushUserTypes, _ := conf.WebsocketConf["PushUserTypes"].([]string)
+	app.Post("/notifications", middleware.RequireToken(pushUserTypes...), internalWebsocket.PushHandler)
+	// the same notifications as server-sent events, for clients that can't upgrade to websockets
+	app.Get("/notifications/stream", internalWebsocket.SSEHandler)
+
+	// events sent by services and batch jobs that don't hold a socket open
+	app.Post("/events", middleware.RequireToken(), ingest.Handler)
+	// events browsers send with navigator.sendBeacon as a page unloads, the token is in the body
+	app.Post("/events/beacon", ingest.BeaconHandler)
+
+	// typed event ingestion for backend services, on a port of its own
+	if grpcAddr, _ := conf.ServerConf["GRPCAddr"].(string); grpcAddr != "" {
+		if err := rpc.Serve(grpcAddr); err != nil {
+			log.Fatalln("couldn't start grpc server:", err)
+		}
+	}
+
+	// who is online, across every instance
+	presenceUserTypes, _ := conf.WebsocketConf["PresenceUserTypes"].([]string)
+	presenceRoutes := app.Group("/presence", middleware.RequireToken(presenceUserTypes...))
+	presenceRoutes.Get("/users", presence.UsersHandler)
+	presenceRoutes.Get("/users/:user", presence.UserHandler)
+	presenceRoutes.Get("/count", presence.CountHandler)
 
 	app.Use("/event", internalWebsocket.EventRequestMiddleWare)
 	go internalWebsocket.SocketHandler()
 
-	app.Get("/event", websocket.New(internalWebsocket.EventCont))
+	// frames are JSON unless the client negotiates another encoding with a subprotocol or the encoding query param
+	app.Get("/event", websocket.New(internalWebsocket.EventCont, websocket.Config{Subprotocols: internalWebsocket.Subprotocols}))
 
-	addr := flag.String("addr", ":3335", "http service address")
-	flag.Parse()
-	app.Listen(*addr)
+	listenErr := make(chan error, 2)
+	metricsApp := app
+	if metricsAddr, _ := conf.ServerConf["MetricsAddr"].(string); metricsAddr != "" {
+		metricsApp = fiber.New(fiber.Config{DisableStartupMessage: true})
+		metricsApp.Get("/metrics", metrics.Handler())
+		go func() {
+			listenErr <- metricsApp.Listen(metricsAddr)
+		}()
+	} else {
+		// on the public port, scrapers have to send a token
+		metricsUserTypes, _ := conf.ServerConf["MetricsUserTypes"].([]string)
+		app.Get("/metrics", middleware.RequireToken(metricsUserTypes...), metrics.Handler())
+	}
+
+	go func() {
+		listenErr <- app.Listen(addr)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		log.Println("received", sig, "shutting down")
+	case err := <-listenErr:
+		log.Println("listen error:", err)
+	}
+	shutdownServer(app, metricsApp)
+}
+
+// initRateLimits sets the limits on the frames clients send, by user type
+func initRateLimits() {
+	limits := make(map[string]ratelimit.Limits, len(conf.RateLimitsConf))
+	for userType, limitConf := range conf.RateLimitsConf {
+		limits[userType] = ratelimit.Limits{
+			User:       ratelimit.Limit{Rate: limitConf.User.Rate, Burst: limitConf.User.Burst},
+			Connection: ratelimit.Limit{Rate: limitConf.Connection.Rate, Burst: limitConf.Connection.Burst},
+		}
+	}
+	if err := ratelimit.Init(limits); err != nil {
+		log.Fatalln("couldn't init rate limits:", err)
+	}
+}
+
+// startNotificationConsumer delivers the messages of the notification topics to the websocket clients
+func startNotificationConsumer() {
+	kafkaBrokers, _ := conf.EventsConf["KafkaBrokers"].([]string)
+	groupID, _ := conf.NotificationsConf["GroupID"].(string)
+	rules := make([]notifications.Rule, 0, len(conf.NotificationRulesConf))
+	for _, ruleConf := range conf.NotificationRulesConf {
+		rules = append(rules, notifications.Rule{
+			Name:     ruleConf.Name,
+			Topic:    ruleConf.Topic,
+			Match:    ruleConf.Match,
+			Target:   ruleConf.Target,
+			Field:    ruleConf.Field,
+			Channel:  ruleConf.Channel,
+			OrgField: ruleConf.OrgField,
+			Payload:  ruleConf.Payload,
+		})
+	}
+	err := notifications.Start(notifications.Config{Brokers: kafkaBrokers, GroupID: groupID, Rules: rules})
+	if err != nil {
+		log.Fatalln("couldn't start notification consumer:", err)
+	}
+}
+
+// shutdownServer drains the server within the shutdown timeout: the websocket
+// clients are closed first so that no more events come in, then the queued
+// events are delivered and the sinks, the event log and redis are closed
+func shutdownServer(app *fiber.App, metricsApp *fiber.App) {
+	timeout, _ := conf.ServerConf["ShutdownTimeout"].(time.Duration)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := notifications.Shutdown(ctx); err != nil {
+		log.Println("couldn't stop notification consumer:", err)
+	}
+	if err := internalWebsocket.Shutdown(ctx); err != nil {
+		log.Println("couldn't close websocket clients:", err)
+	}
+	if err := app.ShutdownWithContext(ctx); err != nil {
+		log.Println("couldn't shut down http server:", err)
+	}
+	if err := rpc.Shutdown(ctx); err != nil {
+		log.Println("couldn't shut down grpc server:", err)
+	}
+	if err := events.Shutdown(ctx); err != nil {
+		log.Println("couldn't drain event pipeline:", err)
+	}
+	if err := redis.Close(); err != nil {
+		log.Println("couldn't close redis clients:", err)
+	}
+	// metrics are served until the end so that the drain can be watched
+	if metricsApp != app {
+		if err := metricsApp.ShutdownWithContext(ctx); err != nil {
+			log.Println("couldn't shut down metrics server:", err)
+		}
+	}
+	log.Println("shutdown complete")
+}
+
+// initEventPipeline sets up the schemas and sinks of pkg/events
+func initEventPipeline() {
+	// init event schemas
+	schemaDir, _ := conf.EventsConf["SchemaDir"].(string)
+	schemaRequired, _ := conf.EventsConf["SchemaRequired"].(bool)
+	if err := schema.Init(schemaDir, schemaRequired); err != nil {
+		log.Fatalln("couldn't load event schemas:", err)
+	}
+
+	// init event sink
+	sinkType, _ := conf.EventsConf["Sink"].(string)
+	kafkaBrokers, _ := conf.EventsConf["KafkaBrokers"].([]string)
+	kafkaTopic, _ := conf.EventsConf["KafkaTopic"].(string)
+	filePath, _ := conf.EventsConf["FilePath"].(string)
+	sink, err := events.NewSink(events.SinkConfig{
+		Type:         sinkType,
+		KafkaBrokers: kafkaBrokers,
+		KafkaTopic:   kafkaTopic,
+		FilePath:     filePath,
+	})
+	if err != nil {
+		log.Fatalln("couldn't init event sink:", err)
+	}
+	events.EventSink = sink
+	events.PartitionKeyFields, _ = conf.EventsConf["PartitionKeys"].([]string)
+
+	// init event routes, routes sharing a destination share its sink
+	sinkKey := func(cfg events.SinkConfig) string {
+		if cfg.Type == events.SinkStdout {
+			return cfg.Type
+		}
+		return cfg.Type + "|" + cfg.KafkaTopic + "|" + cfg.FilePath
+	}
+	sinks := map[string]events.Sink{sinkKey(events.SinkConfig{Type: sinkType, KafkaTopic: kafkaTopic, FilePath: filePath}): sink}
+	routes := make([]events.Route, 0, len(conf.RoutesConf))
+	for _, routeConf := range conf.RoutesConf {
+		sinkConfig := events.SinkConfig{
+			Type:         routeConf.Sink,
+			KafkaBrokers: kafkaBrokers,
+			KafkaTopic:   routeConf.KafkaTopic,
+			FilePath:     routeConf.FilePath,
+		}
+		key := sinkKey(sinkConfig)
+		routeSink, ok := sinks[key]
+		if !ok {
+			routeSink, err = events.NewSink(sinkConfig)
+			if err != nil {
+				log.Fatalf("couldn't init sink of event route %s: %v", routeConf.Name, err)
+			}
+			sinks[key] = routeSink
+		}
+		route := events.Route{
+			Name:       routeConf.Name,
+			EventType:  routeConf.EventType,
+			Source:     routeConf.Source,
+			ObjectType: routeConf.ObjectType,
+			Sink:       routeSink,
+		}
+		if err := route.Validate(); err != nil {
+			log.Fatalln("couldn't init event routes:", err)
+		}
+		routes = append(routes, route)
+	}
+	events.EventRoutes = routes
+
+	// init dead letter sink
+	dlqType, _ := conf.EventsConf["DLQSink"].(string)
+	dlqTopic, _ := conf.EventsConf["DLQKafkaTopic"].(string)
+	dlqFilePath, _ := conf.EventsConf["DLQFilePath"].(string)
+	deadLetterSink, err := events.NewSink(events.SinkConfig{
+		Type:         dlqType,
+		KafkaBrokers: kafkaBrokers,
+		KafkaTopic:   dlqTopic,
+		FilePath:     dlqFilePath,
+	})
+	if err != nil {
+		log.Fatalln("couldn't init dead letter sink:", err)
+	}
+	events.DeadLetterSink = deadLetterSink
+	events.DeliveryAttempts, _ = conf.EventsConf["DeliveryAttempts"].(int)
+
+	// init batching
+	events.Batching.MaxEvents, _ = conf.EventsConf["BatchMaxEvents"].(int)
+	events.Batching.MaxBytes, _ = conf.EventsConf["BatchMaxBytes"].(int)
+	events.Batching.Interval, _ = conf.EventsConf["BatchInterval"].(time.Duration)
+	events.Batching.Workers, _ = conf.EventsConf["BatchWorkers"].(int)
+	events.Batching.QueueSize, _ = conf.EventsConf["QueueSize"].(int)
+}
+
+// openEventLog sets up the event log, batches are kept on disk until the sink accepts them
+func openEventLog() {
+	if walDir, _ := conf.EventsConf["WALDir"].(string); walDir != "" {
+		segmentSize, _ := conf.EventsConf["WALSegmentSize"].(int64)
+		maxBytes, _ := conf.EventsConf["WALMaxBytes"].(int64)
+		maxAge, _ := conf.EventsConf["WALMaxAge"].(time.Duration)
+		eventLog, err := wal.Open(walDir, wal.Options{
+			SegmentSize: segmentSize,
+			MaxBytes:    maxBytes,
+			MaxAge:      maxAge,
+		})
+		if err != nil {
+			log.Fatalln("couldn't open event log:", err)
+		}
+		events.EventLog = eventLog
+	}
+}
+
+// redriveKafkaScheme prefixes the -redrive value naming a kafka topic instead of a file
+const redriveKafkaScheme = "kafka://"
+
+// redriveDeadLetters sends the dead letters of a file or kafka topic through
+// the pipeline again. The event log is left out as it belongs to the running server.
+func redriveDeadLetters(path string) {
+	if strings.HasPrefix(path, redriveKafkaScheme) {
+		redriveDeadLetterTopic(strings.TrimPrefix(path, redriveKafkaScheme))
+		return
+	}
+	if strings.Contains(path, "://") {
+		log.Fatalf("couldn't redrive dead letters: %s is neither a file nor a %s<topic>", path, redriveKafkaScheme)
+	}
+
+	// the configured dead letter file is moved aside, letters failing again
+	// are written to a fresh one instead of being redriven a second time
+	if dlqFilePath, _ := conf.EventsConf["DLQFilePath"].(string); path == dlqFilePath {
+		moved := fmt.Sprintf("%s.%s", path, time.Now().Format("20060102150405"))
+		if err := os.Rename(path, moved); err != nil {
+			log.Fatalln("couldn't move dead letter file:", err)
+		}
+		log.Println("dead letter file moved to", moved)
+		path = moved
+	}
+
+	initEventPipeline()
+	events.InitEvents()
+
+	redriven, failed, err := events.Redrive(context.Background(), path)
+	if shutdownErr := events.Shutdown(context.Background()); shutdownErr != nil {
+		log.Println("couldn't close event pipeline:", shutdownErr)
+	}
+	if err != nil {
+		log.Fatalln("couldn't redrive dead letters:", err)
+	}
+	log.Printf("redrive done: %d events redriven, %d failed again", redriven, failed)
+}
+
+// redriveDeadLetterTopic sends the dead letters of a kafka topic through the
+// pipeline again, the configured dead letter topic when topic is empty
+func redriveDeadLetterTopic(topic string) {
+	if topic == "" {
+		topic, _ = conf.EventsConf["DLQKafkaTopic"].(string)
+	}
+	kafkaBrokers, _ := conf.EventsConf["KafkaBrokers"].([]string)
+	if topic == "" || len(kafkaBrokers) == 0 {
+		log.Fatalln("couldn't redrive dead letters: a kafka topic and brokers are needed")
+	}
+
+	initEventPipeline()
+	events.InitEvents()
+
+	redriven, failed, err := events.RedriveTopic(context.Background(), kafkaBrokers, topic, topic+"-redrive")
+	if shutdownErr := events.Shutdown(context.Background()); shutdownErr != nil {
+		log.Println("couldn't close event pipeline:", shutdownErr)
+	}
+	if err != nil {
+		log.Fatalln("couldn't redrive dead letters:", err)
+	}
+	log.Printf("redrive done: %d events redriven, %d failed again", redriven, failed)
 }
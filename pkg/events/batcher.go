@@ -0,0 +1,115 @@
+package events
+
+import (
+	"time"
+)
+
+// BatchConfig sets how events are batched and written out, see Batching
+type BatchConfig struct {
+	MaxEvents int           // a batch is flushed once it holds this many events
+	MaxBytes  int           // a batch is flushed before it grows past this many bytes
+	Interval  time.Duration // a batch is flushed once its first event waited this long
+	Workers   int           // batches written to the sinks at the same time
+	QueueSize int           // events EventChan holds before TrigerEvent returns ErrorOverloaded
+}
+
+// Batching is read by InitEvents
+var Batching = BatchConfig{
+	MaxEvents: 100,
+	MaxBytes:  1 << 20, // 1 MiB, the default batch size of the kafka writer
+	Interval:  time.Second * 5,
+	Workers:   4,
+	QueueSize: 100,
+}
+
+// Reasons a batch is flushed for
+const (
+	flushSize     = "size"
+	flushBytes    = "bytes"
+	flushInterval = "interval"
+	flushShutdown = "shutdown"
+)
+
+// minTick bounds how often the batcher checks for expired batches
+const minTick = 10 * time.Millisecond
+
+// tick returns the interval expired batches are looked for at, a batch waits
+// at most a quarter of Interval longer than it should
+func (c BatchConfig) tick() time.Duration {
+	if tick := c.Interval / 4; tick > minTick {
+		return tick
+	}
+	return minTick
+}
+
+// routeBatch holds the events of a route waiting to be flushed
+type routeBatch struct {
+	events  []QueuedEvent
+	bytes   int
+	started time.Time
+}
+
+// batcher groups queued events per route, so that a batch never mixes
+// destinations, and hands full or expired batches to flush. It is not safe
+// for concurrent use, eventWorker owns it.
+type batcher struct {
+	cfg     BatchConfig
+	batches map[string]*routeBatch
+	flush   func(route string, queued []QueuedEvent, reason string)
+}
+
+func newBatcher(cfg BatchConfig, flush func(route string, queued []QueuedEvent, reason string)) *batcher {
+	return &batcher{
+		cfg:     cfg,
+		batches: make(map[string]*routeBatch),
+		flush:   flush,
+	}
+}
+
+// add appends the event to the batch of its route, flushing the batch first
+// when the event would take it past MaxBytes, and afterwards when it is full
+func (b *batcher) add(event QueuedEvent, now time.Time) {
+	batch, ok := b.batches[event.Route]
+	if !ok {
+		batch = &routeBatch{}
+		b.batches[event.Route] = batch
+	}
+	if len(batch.events) > 0 && b.cfg.MaxBytes > 0 && batch.bytes+len(event.Data) > b.cfg.MaxBytes {
+		b.flushRoute(event.Route, batch, flushBytes)
+	}
+	if len(batch.events) == 0 {
+		batch.started = now
+	}
+	batch.events = append(batch.events, event)
+	batch.bytes += len(event.Data)
+	if len(batch.events) >= b.cfg.MaxEvents {
+		b.flushRoute(event.Route, batch, flushSize)
+	} else if b.cfg.MaxBytes > 0 && batch.bytes >= b.cfg.MaxBytes {
+		b.flushRoute(event.Route, batch, flushBytes)
+	}
+}
+
+// flushExpired flushes the batches whose first event waited Interval or longer
+func (b *batcher) flushExpired(now time.Time) {
+	for route, batch := range b.batches {
+		if len(batch.events) > 0 && now.Sub(batch.started) >= b.cfg.Interval {
+			b.flushRoute(route, batch, flushInterval)
+		}
+	}
+}
+
+// flushAll flushes every batch holding events, it is called on shutdown
+func (b *batcher) flushAll() {
+	for route, batch := range b.batches {
+		if len(batch.events) > 0 {
+			b.flushRoute(route, batch, flushShutdown)
+		}
+	}
+}
+
+func (b *batcher) flushRoute(route string, batch *routeBatch, reason string) {
+	queued := batch.events
+	batch.events = make([]QueuedEvent, 0, len(queued))
+	batch.bytes = 0
+	b.flush(route, queued, reason)
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package events
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+// BenchmarkPipelineIdle reports the CPU time the pipeline burns per second of
+// wall time while no events come in
+func BenchmarkPipelineIdle(b *testing.B) {
+	startPipeline(b, BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: time.Second * 5, Workers: 4, QueueSize: 100})
+	var before, after syscall.Rusage
+	b.ResetTimer()
+	syscall.Getrusage(syscall.RUSAGE_SELF, &before)
+	for i := 0; i < b.N; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	syscall.Getrusage(syscall.RUSAGE_SELF, &after)
+	cpu := time.Duration(after.Utime.Nano() + after.Stime.Nano() - before.Utime.Nano() - before.Stime.Nano())
+	b.ReportMetric(float64(cpu.Milliseconds())/b.Elapsed().Seconds(), "cpu-ms/s")
+}
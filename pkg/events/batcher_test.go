@@ -0,0 +1,186 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcher(t *testing.T) {
+	type flushed struct {
+		route  string
+		events int
+	}
+	type testStruct struct {
+		cfg    BatchConfig
+		events []QueuedEvent
+		wait   time.Duration // time passed before flushExpired is called
+		exp    []flushed
+	}
+	event := func(route string, size int) QueuedEvent {
+		return QueuedEvent{Route: route, Data: []byte(strings.Repeat("x", size))}
+	}
+	var testCases = []testStruct{
+		// size trigger
+		{BatchConfig{MaxEvents: 2, MaxBytes: 100, Interval: time.Second},
+			[]QueuedEvent{event("a", 1), event("a", 1), event("a", 1)}, 0, []flushed{{"a", 2}}},
+		// routes are batched on their own
+		{BatchConfig{MaxEvents: 2, MaxBytes: 100, Interval: time.Second},
+			[]QueuedEvent{event("a", 1), event("b", 1), event("a", 1)}, 0, []flushed{{"a", 2}}},
+		// byte trigger, the batch is flushed before it grows past MaxBytes
+		{BatchConfig{MaxEvents: 10, MaxBytes: 10, Interval: time.Second},
+			[]QueuedEvent{event("a", 4), event("a", 4), event("a", 4)}, 0, []flushed{{"a", 2}}},
+		// an event of MaxBytes or more is flushed on its own
+		{BatchConfig{MaxEvents: 10, MaxBytes: 10, Interval: time.Second},
+			[]QueuedEvent{event("a", 4), event("a", 12)}, 0, []flushed{{"a", 1}, {"a", 1}}},
+		// time trigger
+		{BatchConfig{MaxEvents: 10, MaxBytes: 100, Interval: time.Second},
+			[]QueuedEvent{event("a", 1), event("b", 1)}, time.Second, []flushed{{"a", 1}, {"b", 1}}},
+		// nothing expired yet
+		{BatchConfig{MaxEvents: 10, MaxBytes: 100, Interval: time.Second},
+			[]QueuedEvent{event("a", 1)}, time.Second / 2, nil},
+	}
+	for index, test := range testCases {
+		var got []flushed
+		b := newBatcher(test.cfg, func(route string, queued []QueuedEvent, reason string) {
+			got = append(got, flushed{route, len(queued)})
+		})
+		start := time.Now()
+		for _, e := range test.events {
+			b.add(e, start)
+		}
+		if test.wait > 0 {
+			b.flushExpired(start.Add(test.wait))
+		}
+		// map iteration order is random, expired batches are compared regardless of order
+		if len(got) != len(test.exp) {
+			t.Errorf("Case %d: flushed batches Error: (expected: %v, got: %v)", index+1, test.exp, got)
+			continue
+		}
+		for _, want := range test.exp {
+			found := false
+			for _, g := range got {
+				found = found || g == want
+			}
+			if !found {
+				t.Errorf("Case %d: flushed batches Error: (expected: %v, got: %v)", index+1, test.exp, got)
+			}
+		}
+	}
+}
+
+// startPipeline runs the pipeline against a memory sink, without event log
+func startPipeline(tb testing.TB, cfg BatchConfig) *MemorySink {
+	sink := NewMemorySink()
+	EventSink, EventLog, EventRoutes, Batching = sink, nil, nil, cfg
+	InitEvents()
+	tb.Cleanup(func() { Shutdown(context.Background()) })
+	return sink
+}
+
+func TestPipelineFlushesOnInterval(t *testing.T) {
+	sink := startPipeline(t, BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: 50 * time.Millisecond, Workers: 2, QueueSize: 10})
+	delivered := make(chan error, 1)
+	start := time.Now()
+	if err := TrigerEvent(EventMessage{EventType: "page_view"}, func(err error) { delivered <- err }); err != nil {
+		t.Fatalf("TrigerEvent Error: (expected: nil, got: %s)", err.Error())
+	}
+	select {
+	case err := <-delivered:
+		if err != nil {
+			t.Errorf("delivery Error: (expected: nil, got: %s)", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delivery Error: (expected: flushed after the interval, got: nothing)")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("delivery Error: (expected: after 50ms, got: %s)", elapsed)
+	}
+	if count := len(sink.Messages()); count != 1 {
+		t.Errorf("sink messages Error: (expected: 1, got: %d)", count)
+	}
+}
+
+// jitterSink delays every write a little, so that concurrent writes finish in any order
+type jitterSink struct {
+	*MemorySink
+}
+
+func (s jitterSink) Write(ctx context.Context, batch []Message) error {
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+	return s.MemorySink.Write(ctx, batch)
+}
+
+func TestPipelineKeepsKeyOrder(t *testing.T) {
+	sink := startPipeline(t, BatchConfig{MaxEvents: 3, MaxBytes: 1 << 20, Interval: time.Millisecond, Workers: 4, QueueSize: 500})
+	EventSink = jitterSink{sink}
+
+	const loans, perLoan = 8, 40
+	for i := 0; i < perLoan; i++ {
+		for loan := 0; loan < loans; loan++ {
+			event := EventMessage{EventType: "loan_update", Name: strconv.Itoa(i), LoanMetaData: LoanMetaData{LoanApplicationId: "la-" + strconv.Itoa(loan)}}
+			if err := TrigerEvent(event, nil); err != nil {
+				t.Fatalf("TrigerEvent Error: (expected: nil, got: %s)", err.Error())
+			}
+		}
+	}
+	Shutdown(context.Background())
+
+	next := map[string]int{}
+	for _, message := range sink.Messages() {
+		var event EventMessage
+		json.Unmarshal(message.Value, &event)
+		loan := event.LoanMetaData.LoanApplicationId
+		if seq, _ := strconv.Atoi(event.Name); seq != next[loan] {
+			t.Fatalf("%s order Error: (expected: %d, got: %d)", loan, next[loan], seq)
+		}
+		next[loan]++
+	}
+	if count := len(sink.Messages()); count != loans*perLoan {
+		t.Errorf("sink messages Error: (expected: %d, got: %d)", loans*perLoan, count)
+	}
+}
+
+func TestShutdownDrainsPipeline(t *testing.T) {
+	sink := startPipeline(t, BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: time.Hour, Workers: 2, QueueSize: 10})
+	for i := 0; i < 5; i++ {
+		if err := TrigerEvent(EventMessage{EventType: "page_view"}, nil); err != nil {
+			t.Fatalf("TrigerEvent Error: (expected: nil, got: %s)", err.Error())
+		}
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown Error: (expected: nil, got: %s)", err.Error())
+	}
+	if count := len(sink.Messages()); count != 5 {
+		t.Errorf("sink messages Error: (expected: 5, got: %d)", count)
+	}
+	if err := TrigerEvent(EventMessage{EventType: "page_view"}, nil); err != ErrorShuttingDown {
+		t.Errorf("TrigerEvent Error: (expected: %v, got: %v)", ErrorShuttingDown, err)
+	}
+}
+
+func BenchmarkPipelineThroughput(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			startPipeline(b, BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: 10 * time.Millisecond, Workers: workers, QueueSize: 1000})
+			event := EventMessage{EventType: "page_view", Screen: "home", LoanMetaData: LoanMetaData{LoanApplicationId: "la-1"}}
+			var wg sync.WaitGroup
+			done := func(error) { wg.Done() }
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				wg.Add(1)
+				for TrigerEvent(event, done) == ErrorOverloaded {
+					time.Sleep(time.Microsecond)
+				}
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-event-management/internal/metrics"
+	"go-event-management/pkg/events/schema"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Stages an event can be dead-lettered at
+const (
+	StageValidation = "validation"
+	StageQueue      = "queue" // valid events the pipeline couldn't take, see DeadLetterEvent
+	StageDelivery   = "delivery"
+)
+
+var ErrorDeadLettered = errors.New("events: delivery failed, event was dead-lettered")
+
+var (
+	DeadLetterSink   Sink // optional, events that fail validation, queueing or delivery are written to it
+	DeliveryAttempts = 5  // sink writes tried before a batch is dead-lettered
+)
+
+// DeadLetter is an event that couldn't be validated or delivered, along with the reason
+type DeadLetter struct {
+	Payload        string    `json:"payload"`
+	Reason         string    `json:"reason"`
+	Stage          string    `json:"stage"`
+	Route          string    `json:"route,omitempty"`
+	Attempts       int       `json:"attempts"`
+	FirstAttemptAt time.Time `json:"first_attempt_at"`
+	FailedAt       time.Time `json:"failed_at"`
+}
+
+// DeadLetterPayload records a payload that was rejected before reaching the pipeline
+func DeadLetterPayload(payload []byte, reason error) {
+	if err := deadLetterPayload(payload, reason, StageValidation); err != nil {
+		log.Errorf("[DeadLetterPayload] failed to write dead letter. err: %v", err)
+	}
+}
+
+// DeadLetterEvent records a valid event that TrigerEvent couldn't queue, because
+// the pipeline was overloaded or shutting down, so that it can be redriven
+func DeadLetterEvent(event EventMessage, reason error) {
+	payload, err := json.Marshal(event)
+	if err == nil {
+		err = deadLetterPayload(payload, reason, StageQueue)
+	}
+	if err != nil {
+		log.Errorf("[DeadLetterEvent] failed to write dead letter. err: %v", err)
+	}
+}
+
+func deadLetterPayload(payload []byte, reason error, stage string) error {
+	now := time.Now()
+	return writeDeadLetters([]DeadLetter{{
+		Payload:        string(payload),
+		Reason:         reason.Error(),
+		Stage:          stage,
+		Attempts:       1,
+		FirstAttemptAt: now,
+		FailedAt:       now,
+	}})
+}
+
+// deliverBatch writes the batch to the sink of the route, retrying with exponential backoff.
+// After DeliveryAttempts failures the events are dead-lettered and
+// ErrorDeadLettered is returned. Any other error means neither sink took the batch.
+func deliverBatch(ctx context.Context, route string, batch []Message) error {
+	firstAttemptAt := time.Now()
+	backoff := shipMinBackoff
+	for attempt := 1; ; attempt++ {
+		err := WriteMessageToSink(ctx, route, batch)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= DeliveryAttempts {
+			if dlErr := deadLetterBatch(route, batch, err, attempt, firstAttemptAt); dlErr != nil {
+				log.Errorf("[deliverBatch] failed to dead-letter batch. err: %v", dlErr)
+				return err
+			}
+			return fmt.Errorf("%w: %v", ErrorDeadLettered, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > shipMaxBackoff {
+			backoff = shipMaxBackoff
+		}
+	}
+}
+
+func deadLetterBatch(route string, batch []Message, reason error, attempts int, firstAttemptAt time.Time) error {
+	now := time.Now()
+	letters := make([]DeadLetter, 0, len(batch))
+	for _, message := range batch {
+		letters = append(letters, DeadLetter{
+			Payload:        string(message.Value),
+			Reason:         reason.Error(),
+			Stage:          StageDelivery,
+			Route:          route,
+			Attempts:       attempts,
+			FirstAttemptAt: firstAttemptAt,
+			FailedAt:       now,
+		})
+	}
+	return writeDeadLetters(letters)
+}
+
+func writeDeadLetters(letters []DeadLetter) error {
+	if DeadLetterSink == nil {
+		return errors.New("events: no dead letter sink configured")
+	}
+	// letters keep the partition key of their event, so that the letters of a
+	// loan are redriven in order
+	batch := make([]Message, 0, len(letters))
+	for _, letter := range letters {
+		data, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, Message{Key: partitionKey([]byte(letter.Payload)), Value: data})
+	}
+	if err := DeadLetterSink.Write(context.Background(), batch); err != nil {
+		return err
+	}
+	for _, letter := range letters {
+		metrics.DeadLetters.WithLabelValues(letter.Stage).Inc()
+	}
+	return nil
+}
+
+// Redrive reads the dead letters of an NDJSON file, as written by the file
+// sink, and sends them through the pipeline again. Letters that still fail
+// validation are dead-lettered again. It returns once every redriven event
+// has been handed to the sink or dead-lettered.
+func Redrive(ctx context.Context, path string) (redriven int, failed int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// only the letters present now are read, so that letters failing again
+	// and appended to the same file are not picked up in a loop
+	scanner := bufio.NewScanner(io.LimitReader(f, info.Size()))
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	return redriveLetters(ctx, func(ctx context.Context) ([]byte, error) {
+		for scanner.Scan() {
+			if len(scanner.Bytes()) > 0 {
+				return scanner.Bytes(), nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	})
+}
+
+// redriveLetters sends the dead letters returned by next through the pipeline
+// again until next returns io.EOF, see Redrive
+func redriveLetters(ctx context.Context, next func(ctx context.Context) ([]byte, error)) (redriven int, failed int, err error) {
+	var wg sync.WaitGroup
+	for {
+		line, err := next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return redriven, failed, err
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(line, &letter); err != nil {
+			log.Errorf("[Redrive] skipping unreadable dead letter. err: %v", err)
+			failed++
+			continue
+		}
+		var event EventMessage
+		if err := json.Unmarshal([]byte(letter.Payload), &event); err != nil {
+			DeadLetterPayload([]byte(letter.Payload), err)
+			failed++
+			continue
+		}
+		if err := schema.Validate([]byte(letter.Payload)); err != nil {
+			DeadLetterPayload([]byte(letter.Payload), err)
+			failed++
+			continue
+		}
+		wg.Add(1)
+		for {
+			err = TrigerEvent(event, func(error) { wg.Done() })
+			if !errors.Is(err, ErrorOverloaded) {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				wg.Done()
+				return redriven, failed, ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		if err != nil {
+			wg.Done()
+			failed++
+			continue
+		}
+		redriven++
+	}
+	wg.Wait()
+	return redriven, failed, nil
+}
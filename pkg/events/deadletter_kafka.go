@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// redriveIdleTimeout ends RedriveTopic once no letter came for this long, the
+// partitions whose letters were all redriven by an earlier run stay silent
+var redriveIdleTimeout = 10 * time.Second
+
+// RedriveTopic sends the dead letters of a kafka topic, as written by the
+// kafka sink, through the pipeline again like Redrive. Letters are read by the
+// consumer group groupID and committed once redriven, so that a later run
+// starts where this one stopped. Only the letters present when it starts are
+// read, letters failing again are left for the next run.
+func RedriveTopic(ctx context.Context, brokers []string, topic string, groupID string) (redriven int, failed int, err error) {
+	ends, err := topicEnds(ctx, brokers, topic)
+	if err != nil {
+		return 0, 0, err
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		GroupID:     groupID,
+		Topic:       topic,
+		MaxWait:     time.Second,
+		StartOffset: kafka.FirstOffset,
+	})
+	defer reader.Close()
+
+	// partitions whose letters present at the start were all read
+	finished := make(map[int]bool, len(ends))
+	for partition, end := range ends {
+		if end == 0 {
+			finished[partition] = true
+		}
+	}
+	var fetched []kafka.Message
+	redriven, failed, err = redriveLetters(ctx, func(ctx context.Context) ([]byte, error) {
+		for len(finished) < len(ends) {
+			fetchCtx, cancel := context.WithTimeout(ctx, redriveIdleTimeout)
+			msg, err := reader.FetchMessage(fetchCtx)
+			cancel()
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return nil, io.EOF
+			}
+			if err != nil {
+				return nil, err
+			}
+			end := ends[msg.Partition]
+			if msg.Offset >= end-1 {
+				finished[msg.Partition] = true
+			}
+			if msg.Offset >= end {
+				continue // written after the start, possibly by this run, it is left uncommitted
+			}
+			fetched = append(fetched, msg)
+			return msg.Value, nil
+		}
+		return nil, io.EOF
+	})
+	if len(fetched) > 0 {
+		// the redriven events have been handed to the sink, see redriveLetters
+		if commitErr := reader.CommitMessages(context.Background(), fetched...); commitErr != nil && err == nil {
+			err = fmt.Errorf("events: redriven dead letters were not committed: %w", commitErr)
+		}
+	}
+	return redriven, failed, err
+}
+
+// topicEnds returns the offset following the last message of every partition of the topic
+func topicEnds(ctx context.Context, brokers []string, topic string) (map[int]int64, error) {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, err
+	}
+	var requests []kafka.OffsetRequest
+	for _, t := range metadata.Topics {
+		if t.Error != nil {
+			return nil, fmt.Errorf("topic %s: %w", t.Name, t.Error)
+		}
+		for _, partition := range t.Partitions {
+			requests = append(requests, kafka.LastOffsetOf(partition.ID))
+		}
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+	ends := make(map[int]int64, len(requests))
+	for _, partition := range offsets.Topics[topic] {
+		if partition.Error != nil {
+			return nil, fmt.Errorf("topic %s partition %d: %w", topic, partition.Partition, partition.Error)
+		}
+		ends[partition.Partition] = partition.LastOffset
+	}
+	return ends, nil
+}
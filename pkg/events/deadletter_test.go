@@ -0,0 +1,234 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakySink fails the first fails writes, then writes to its memory sink
+type flakySink struct {
+	*MemorySink
+	mu     sync.Mutex
+	fails  int
+	writes int
+}
+
+func (s *flakySink) Write(ctx context.Context, batch []Message) error {
+	s.mu.Lock()
+	s.writes++
+	failed := s.writes <= s.fails
+	s.mu.Unlock()
+	if failed {
+		return errors.New("sink down")
+	}
+	return s.MemorySink.Write(ctx, batch)
+}
+
+// readLetters returns the dead letters written to sink
+func readLetters(sink *MemorySink) []DeadLetter {
+	var letters []DeadLetter
+	for _, message := range sink.Messages() {
+		var letter DeadLetter
+		json.Unmarshal(message.Value, &letter)
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func TestDeadLetterWrites(t *testing.T) {
+	defer func(fields []string) { PartitionKeyFields = fields }(PartitionKeyFields)
+	PartitionKeyFields = []string{"loan_meta_data.loan_application_id", "user"}
+	defer func() { DeadLetterSink = nil }()
+
+	type testStruct struct {
+		write    func()
+		expStage string
+		expKey   string
+		expErr   string
+	}
+	var testCases = []testStruct{
+		{func() { DeadLetterPayload([]byte(`{"event_type":1,"user":"u-1"}`), errors.New("schema violation")) }, StageValidation, "u-1", "schema violation"},
+		{func() { DeadLetterPayload([]byte(`not json`), errors.New("invalid json")) }, StageValidation, "", "invalid json"},
+		{func() {
+			DeadLetterEvent(EventMessage{EventType: "click", LoanMetaData: LoanMetaData{LoanApplicationId: "la-1"}}, ErrorOverloaded)
+		}, StageQueue, "la-1", ErrorOverloaded.Error()},
+		{func() { DeadLetterEvent(EventMessage{EventType: "click", User: "u-2"}, ErrorShuttingDown) }, StageQueue, "u-2", ErrorShuttingDown.Error()},
+	}
+	for index, test := range testCases {
+		sink := NewMemorySink()
+		DeadLetterSink = sink
+		test.write()
+		messages := sink.Messages()
+		if len(messages) != 1 {
+			t.Errorf("Case %d: dead letters Error: (expected: 1, got: %d)", index+1, len(messages))
+			continue
+		}
+		letter := readLetters(sink)[0]
+		if letter.Stage != test.expStage || letter.Reason != test.expErr || letter.Attempts != 1 {
+			t.Errorf("Case %d: dead letter Error: (expected: %s %s 1, got: %s %s %d)", index+1, test.expStage, test.expErr, letter.Stage, letter.Reason, letter.Attempts)
+		}
+		if key := string(messages[0].Key); key != test.expKey {
+			t.Errorf("Case %d: dead letter key Error: (expected: %s, got: %s)", index+1, test.expKey, key)
+		}
+	}
+
+	// letters are dropped, not panicked on, without a dead letter sink
+	DeadLetterSink = nil
+	DeadLetterPayload([]byte(`{}`), errors.New("invalid"))
+}
+
+func TestDeliverBatch(t *testing.T) {
+	defer func(attempts int, minBackoff, maxBackoff time.Duration) {
+		DeliveryAttempts, shipMinBackoff, shipMaxBackoff = attempts, minBackoff, maxBackoff
+	}(DeliveryAttempts, shipMinBackoff, shipMaxBackoff)
+	shipMinBackoff, shipMaxBackoff = 10*time.Millisecond, 25*time.Millisecond
+	EventRoutes = nil
+	defer func() { EventSink, DeadLetterSink = nil, nil }()
+
+	type testStruct struct {
+		attempts      int
+		fails         int
+		deadLetters   bool // whether a dead letter sink is configured
+		expErr        error
+		expWrites     int
+		expDelivered  int
+		expLetters    int
+		expMinElapsed time.Duration // backoff waited between the attempts
+	}
+	var testCases = []testStruct{
+		{3, 0, true, nil, 1, 2, 0, 0},
+		// backoff doubles from shipMinBackoff: 10ms + 20ms
+		{3, 2, true, nil, 3, 2, 0, 30 * time.Millisecond},
+		{3, 5, true, ErrorDeadLettered, 3, 0, 2, 30 * time.Millisecond},
+		// backoff is capped at shipMaxBackoff: 10ms + 20ms + 25ms
+		{4, 5, true, ErrorDeadLettered, 4, 0, 2, 55 * time.Millisecond},
+		// without a dead letter sink the error of the sink is returned
+		{1, 5, false, errors.New("sink down"), 1, 0, 0, 0},
+	}
+	batch := []Message{
+		{Key: []byte("la-1"), Value: []byte(`{"event_type":"a"}`)},
+		{Key: []byte("la-1"), Value: []byte(`{"event_type":"b"}`)},
+	}
+	for index, test := range testCases {
+		DeliveryAttempts = test.attempts
+		sink := &flakySink{MemorySink: NewMemorySink(), fails: test.fails}
+		EventSink = sink
+		letters := NewMemorySink()
+		DeadLetterSink = nil
+		if test.deadLetters {
+			DeadLetterSink = letters
+		}
+
+		start := time.Now()
+		err := deliverBatch(context.Background(), DefaultRoute, batch)
+		elapsed := time.Since(start)
+		switch {
+		case test.expErr == nil && err != nil,
+			test.expErr != nil && err == nil,
+			test.expErr == ErrorDeadLettered && !errors.Is(err, ErrorDeadLettered),
+			test.expErr != nil && test.expErr != ErrorDeadLettered && (errors.Is(err, ErrorDeadLettered) || err.Error() != test.expErr.Error()):
+			t.Errorf("Case %d: deliverBatch Error: (expected: %v, got: %v)", index+1, test.expErr, err)
+		}
+		if sink.writes != test.expWrites {
+			t.Errorf("Case %d: sink writes Error: (expected: %d, got: %d)", index+1, test.expWrites, sink.writes)
+		}
+		if count := len(sink.Messages()); count != test.expDelivered {
+			t.Errorf("Case %d: delivered Error: (expected: %d, got: %d)", index+1, test.expDelivered, count)
+		}
+		if elapsed < test.expMinElapsed {
+			t.Errorf("Case %d: backoff Error: (expected: at least %s, got: %s)", index+1, test.expMinElapsed, elapsed)
+		}
+		deadLetters := readLetters(letters)
+		if len(deadLetters) != test.expLetters {
+			t.Errorf("Case %d: dead letters Error: (expected: %d, got: %d)", index+1, test.expLetters, len(deadLetters))
+		}
+		for _, letter := range deadLetters {
+			if letter.Stage != StageDelivery || letter.Route != DefaultRoute || letter.Attempts != test.attempts || letter.Reason != "sink down" {
+				t.Errorf("Case %d: dead letter Error: (expected: %s %s %d sink down, got: %s %s %d %s)", index+1, StageDelivery, DefaultRoute, test.attempts, letter.Stage, letter.Route, letter.Attempts, letter.Reason)
+			}
+		}
+	}
+
+	// the backoff is given up once the pipeline is cancelled
+	DeliveryAttempts = 3
+	EventSink = &flakySink{MemorySink: NewMemorySink(), fails: 5}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := deliverBatch(ctx, DefaultRoute, batch); err != context.Canceled {
+		t.Errorf("deliverBatch Error: (expected: %v, got: %v)", context.Canceled, err)
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	letter := func(payload string) string {
+		data, _ := json.Marshal(DeadLetter{Payload: payload, Reason: "sink down", Stage: StageDelivery, Attempts: 5})
+		return string(data)
+	}
+	type testStruct struct {
+		lines       []string
+		expRedriven int
+		expFailed   int
+		expLetters  int // lines of the file after the redrive
+	}
+	var testCases = []testStruct{
+		{[]string{letter(`{"event_type":"a"}`), letter(`{"event_type":"b"}`)}, 2, 0, 2},
+		{[]string{letter(`{"event_type":"a"}`), "", letter(`{"event_type":"b"}`)}, 2, 0, 2},
+		// the payload is still broken, it is dead-lettered again at the end of the file
+		{[]string{letter(`{"event_type":"a"}`), letter(`not json`)}, 1, 1, 3},
+		// an unreadable letter is skipped and kept
+		{[]string{`not a letter`, letter(`{"event_type":"a"}`)}, 1, 1, 2},
+		{nil, 0, 0, 0},
+	}
+	defer func() { DeadLetterSink = nil }()
+	for index, test := range testCases {
+		sink := startPipeline(t, BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: time.Millisecond, Workers: 1, QueueSize: 10})
+		path := filepath.Join(t.TempDir(), "dead-letters.ndjson")
+		content := strings.Join(test.lines, "\n")
+		if content != "" {
+			content += "\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		letters, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		DeadLetterSink = letters
+
+		redriven, failed, err := Redrive(context.Background(), path)
+		letters.Close()
+		if err != nil {
+			t.Errorf("Case %d: Redrive Error: (expected: nil, got: %s)", index+1, err.Error())
+		}
+		if redriven != test.expRedriven || failed != test.expFailed {
+			t.Errorf("Case %d: Redrive Error: (expected: %d redriven %d failed, got: %d %d)", index+1, test.expRedriven, test.expFailed, redriven, failed)
+		}
+		// every redriven event reached the sink by the time Redrive returned
+		if count := len(sink.Messages()); count != test.expRedriven {
+			t.Errorf("Case %d: sink messages Error: (expected: %d, got: %d)", index+1, test.expRedriven, count)
+		}
+		data, _ := os.ReadFile(path)
+		count := 0
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				count++
+			}
+		}
+		if count != test.expLetters {
+			t.Errorf("Case %d: dead letter lines Error: (expected: %d, got: %d)", index+1, test.expLetters, count)
+		}
+		Shutdown(context.Background())
+	}
+
+	if _, _, err := Redrive(context.Background(), filepath.Join(t.TempDir(), "missing.ndjson")); !os.IsNotExist(err) {
+		t.Errorf("Redrive Error: (expected: not exist, got: %v)", err)
+	}
+}
@@ -2,58 +2,157 @@ package events
 
 import (
 	"context"
+	"errors"
+	"go-event-management/internal/metrics"
+	"hash/fnv"
+	"time"
 
 	"github.com/gofiber/fiber/v2/log"
-	kafka "github.com/segmentio/kafka-go"
 	"k8s.io/apimachinery/pkg/util/json"
 )
 
-func eventWorker() {
+var (
+	ErrorOverloaded   = errors.New("events: event queue is full")
+	ErrorShuttingDown = errors.New("events: pipeline is shutting down")
+)
+
+// eventWorker batches the events of EventChan and dispatches the batches it
+// flushes. It waits on the ticker in between events instead of polling.
+func eventWorker(writes []chan queuedBatch) {
+	defer func() {
+		for _, w := range writes {
+			close(w)
+		}
+	}()
+	ticker := time.NewTicker(Batching.tick())
+	defer ticker.Stop()
 
+	batches := newBatcher(Batching, func(route string, queued []QueuedEvent, reason string) {
+		metrics.BatchSize.WithLabelValues(route).Observe(float64(len(queued)))
+		metrics.BatchFlushes.WithLabelValues(route, reason).Inc()
+		dispatchBatch(writes, route, queued)
+	})
 	for {
-		// Do a non-blocking read from a data source.
+		heartbeat.Store(time.Now().UnixNano())
 		select {
-		case data := <-EventChan:
-			// If read succeeds write it out. This will flush if the batch
-			// exceeds the batch size.
-			Batcher.Write(data)
+		case event := <-EventChan:
+			batches.add(event, time.Now())
+		case now := <-ticker.C:
+			batches.flushExpired(now)
 		case <-Done:
+			// TrigerEvent stopped queueing before Done was closed, what is
+			// left in EventChan is the last of the events
+			for len(EventChan) > 0 {
+				batches.add(<-EventChan, time.Now())
+			}
+			batches.flushAll()
 			return
-		default:
-			// If read fails make sure to call Flush to ensure data doesn't
-			// get stuck in the batch for long periods of time.
-			Batcher.Flush()
 		}
 	}
 }
 
-func byteTokafkaMessage(batch [][]byte) []kafka.Message {
-	var kafkaMessages []kafka.Message
-	for _, data := range batch {
-		kafkaMessages = append(kafkaMessages, kafka.Message{
-			Value: data,
-		})
-
-	}
-	return kafkaMessages
-}
-
-func TrigerEvent(event EventMessage) {
+// TrigerEvent queues the event for batching, it returns ErrorOverloaded instead
+// of blocking when the queue is full and ErrorShuttingDown once Shutdown is
+// called. done is optional and is called with the result of the sink write
+// once the batch holding the event is delivered.
+func TrigerEvent(event EventMessage, done func(error)) error {
 
 	ctx := context.Background()
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
 		log.WithContext(ctx).Errorf("[TrigerEvent] failed Marshal event. err: %v", err)
+		return err
+	}
+	queue.RLock()
+	defer queue.RUnlock()
+	if queue.closed {
+		return ErrorShuttingDown
+	}
+	select {
+	case EventChan <- QueuedEvent{Data: eventBytes, Key: eventPartitionKey(event), Route: routeEvent(event), Done: done}:
+		return nil
+	default:
+		return ErrorOverloaded
 	}
-	EventChan <- eventBytes
 
 }
 
-func WriteMessageToKafka(messages []kafka.Message) {
-	ctx := context.Background()
-	err := KafkaConn.WriteMessages(context.Background(), messages...)
+// queuedBatch is a flushed batch waiting for a write worker
+type queuedBatch struct {
+	route  string
+	queued []QueuedEvent
+	batch  []Message
+}
+
+// dispatchBatch appends a flushed batch to EventLog when it is configured, in
+// the order batches are flushed, and otherwise, or when the log cannot take
+// it, hands it to the write workers. The events of a partition key always go
+// to the same worker, so that they are written in the order they were queued
+// with the workers writing concurrently. It blocks while a worker is busy, so
+// that EventChan fills up and TrigerEvent starts to report ErrorOverloaded.
+func dispatchBatch(writes []chan queuedBatch, route string, queued []QueuedEvent) {
+	batch := make([]Message, 0, len(queued))
+	for _, event := range queued {
+		batch = append(batch, Message{Key: event.Key, Value: event.Data})
+	}
+	if EventLog != nil {
+		err := logBatch(route, queued, batch)
+		if err == nil {
+			return
+		}
+		log.Errorf("[dispatchBatch] failed to append batch to event log, writing to sink directly. err: %v", err)
+	}
+
+	parts := make([]queuedBatch, len(writes))
+	for index, event := range queued {
+		worker := writerIndex(event.Key, index, len(writes))
+		parts[worker].queued = append(parts[worker].queued, event)
+		parts[worker].batch = append(parts[worker].batch, batch[index])
+	}
+	for worker, part := range parts {
+		if len(part.queued) > 0 {
+			part.route = route
+			writes[worker] <- part
+		}
+	}
+}
+
+// writerIndex returns the write worker of an event, by the hash of its
+// partition key. Events without a key are spread by their index in the batch.
+func writerIndex(key []byte, index int, workers int) int {
+	if len(key) == 0 {
+		return index % workers
+	}
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// writeWorker writes batches straight to the sink of their route until writes
+// is closed, writes in flight are given up once ctx is cancelled
+func writeWorker(ctx context.Context, writes <-chan queuedBatch) {
+	for batch := range writes {
+		err := deliverBatch(ctx, batch.route, batch.batch)
+		for _, event := range batch.queued {
+			if event.Done != nil {
+				event.Done(err)
+			}
+		}
+	}
+}
+
+// WriteMessageToSink writes the batch to the sink of the route
+func WriteMessageToSink(ctx context.Context, route string, batch []Message) error {
+	sink, err := routeSink(route)
+	if err == nil {
+		start := time.Now()
+		err = sink.Write(ctx, batch)
+		metrics.SinkWriteDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	}
 
 	if err != nil {
-		log.WithContext(ctx).Errorf("[WriteMessageToKafka] failed to write messages. err: %v", err)
+		metrics.SinkWriteErrors.WithLabelValues(route).Inc()
+		log.WithContext(ctx).Errorf("[WriteMessageToSink] failed to write messages to route %s. err: %v", route, err)
 	}
+	return err
 }
@@ -0,0 +1,5 @@
+// Package eventspb holds the gRPC event ingestion API and the protobuf frames of
+// the websocket, generated from events.proto
+package eventspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative events.proto
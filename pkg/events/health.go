@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var ErrorWedged = errors.New("events: batcher is wedged")
+
+// wedgedAfter is how long eventWorker may go without a turn before
+// CheckPipeline reports it, it takes a turn at least on every tick
+const wedgedAfter = 30 * time.Second
+
+// heartbeat holds the unix nano time of the last turn of eventWorker
+var heartbeat atomic.Int64
+
+// CheckPipeline reports whether events are still being batched. eventWorker
+// stops taking turns when every write worker is stuck on a sink write.
+func CheckPipeline(ctx context.Context) error {
+	queue.RLock()
+	closed := queue.closed
+	queue.RUnlock()
+	if closed {
+		return ErrorShuttingDown
+	}
+	if EventChan == nil {
+		return errors.New("events: pipeline is not started")
+	}
+	if since := time.Since(time.Unix(0, heartbeat.Load())); since > max(wedgedAfter, 2*Batching.tick()) {
+		return fmt.Errorf("%w: no turn for %s, %d events queued", ErrorWedged, since.Round(time.Second), len(EventChan))
+	}
+	return nil
+}
+
+// CheckSinks checks that the destination of every sink implementing Checker is reachable
+func CheckSinks(ctx context.Context) error {
+	var errs []error
+	for _, sink := range pipelineSinks() {
+		if checker, ok := sink.(Checker); ok {
+			if err := checker.Check(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pipelineSinks returns every sink of the pipeline once, routes can share a sink
+func pipelineSinks() []Sink {
+	sinks := []Sink{EventSink}
+	for _, route := range EventRoutes {
+		sinks = append(sinks, route.Sink)
+	}
+	sinks = append(sinks, DeadLetterSink)
+
+	var result []Sink
+	seen := make(map[Sink]bool)
+	for _, sink := range sinks {
+		if sink == nil || seen[sink] {
+			continue
+		}
+		seen[sink] = true
+		result = append(result, sink)
+	}
+	return result
+}
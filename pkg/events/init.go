@@ -1,27 +1,62 @@
 package events
 
 import (
-	"bytes"
-	"fmt"
+	"context"
+	"go-event-management/internal/metrics"
+	"sync"
 	"time"
+)
+
+// queue guards EventChan against events queued after Shutdown started draining it
+var queue struct {
+	sync.RWMutex
+	closed bool
+}
 
-	"code.cloudfoundry.org/go-batching"
+var (
+	writing        sync.WaitGroup // eventWorker and the write workers
+	shipping       sync.WaitGroup // shipEvents
+	cancelPipeline context.CancelFunc
 )
 
 func InitEvents() {
-	go eventWorker()
+	metrics.QueueGauges(
+		func() float64 { return float64(len(EventChan)) },
+		func() float64 { return float64(cap(EventChan)) },
+	)
+	EventChan = make(chan QueuedEvent, Batching.QueueSize)
+	Done = make(chan struct{})
+	queue.Lock()
+	queue.closed = false
+	queue.Unlock()
 
-	writer := batching.ByteWriterFunc(func(batch [][]byte) {
-		result := bytes.Join(batch, nil)
+	// sink writes in flight are given up once the pipeline is cancelled
+	var ctx context.Context
+	ctx, cancelPipeline = context.WithCancel(context.Background())
 
-		fmt.Printf("Inside writer %s\n", result)
-		messages := byteTokafkaMessage(batch)
-		go WriteMessageToKafka(messages)
-	})
+	// flushed batches wait here for their worker, at most Workers of them
+	// are written at a time. Every worker has its own queue, see dispatchBatch.
+	writes := make([]chan queuedBatch, Batching.Workers)
+	heartbeat.Store(time.Now().UnixNano())
+	writing.Add(Batching.Workers + 1)
+	for i := range writes {
+		writes[i] = make(chan queuedBatch)
+		go func(writes <-chan queuedBatch) {
+			defer writing.Done()
+			writeWorker(ctx, writes)
+		}(writes[i])
+	}
+	go func() {
+		defer writing.Done()
+		eventWorker(writes)
+	}()
 
-	//TODO:  move size and interval to constant
-	Batcher = batching.NewByteBatcher(100, time.Second*5, writer)
-	EventChan = make(chan []byte, 100)
-	Done = make(chan struct{})
+	if EventLog != nil {
+		shipping.Add(1)
+		go func() {
+			defer shipping.Done()
+			shipEvents(ctx)
+		}()
+	}
 
 }
@@ -1,17 +1,24 @@
 package events
 
 import (
-	"code.cloudfoundry.org/go-batching"
-	kafka "github.com/segmentio/kafka-go"
+	"go-event-management/pkg/events/wal"
 )
 
 var (
-	Batcher   *batching.ByteBatcher
-	EventChan chan []byte
+	EventChan chan QueuedEvent
 	Done      chan struct{}
-	KafkaConn *kafka.Writer
+	EventSink Sink
+	EventLog  *wal.Log // optional, batches go through it before reaching EventSink
 )
 
+// QueuedEvent is a marshalled event waiting in EventChan to be batched
+type QueuedEvent struct {
+	Data  []byte
+	Key   []byte // partition key, see PartitionKeyFields
+	Route string // name of the route the event is batched and delivered by
+	Done  func(error)
+}
+
 // type EventMessage struct {
 // 	EventType      string `json:"event_type"`
 // 	SourceEntityID string `json:"source_entity_id"`
@@ -36,6 +43,8 @@ type EventMessage struct {
 	ActionDetails  string       `json:"action_details"`
 	SessionDetails string       `json:"session_details"`
 	Source         string       `json:"source"`
+	OrganizationID string       `json:"organization_id"`
+	SchemaVersion  string       `json:"schema_version,omitempty"`
 }
 
 type LoanMetaData struct {
@@ -44,3 +53,13 @@ type LoanMetaData struct {
 	Program           string `json:"program"`
 	Status            string `json:"status"`
 }
+
+// SetActor overwrites the actor of the event with the identity verified at
+// connection time, so that it cannot be spoofed through the payload. User is
+// overwritten as well, it is the partition key of events without a loan.
+func (e *EventMessage) SetActor(userID string, userType string, orgID string) {
+	e.User = userID
+	e.ActionBy = userID
+	e.UserType = userType
+	e.OrganizationID = orgID
+}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// PartitionKeyFields are the dotted paths of the event fields the partition
+// key is read from, the first one holding a value is used. Events without any
+// of them get no key and are spread across the partitions.
+// The order of a key holds whether batches go through EventLog, which ships
+// them one at a time, or straight to the write workers, as the events of a key
+// are all written by the same worker.
+var PartitionKeyFields = []string{
+	"loan_meta_data.loan_application_id",
+	"loan_meta_data.customer_id",
+	"user",
+}
+
+// eventPartitionKey returns the partition key of an event, it reads the fields
+// of the typed event instead of decoding the marshalled one again
+func eventPartitionKey(event EventMessage) []byte {
+	value := reflect.ValueOf(event)
+	for _, field := range PartitionKeyFields {
+		if key := structField(value, field); key != "" {
+			return []byte(key)
+		}
+	}
+	return nil
+}
+
+// structField returns the string found at the dotted path of json names in a
+// struct, or "" when there is none
+func structField(value reflect.Value, path string) string {
+	for _, name := range strings.Split(path, ".") {
+		if value.Kind() != reflect.Struct {
+			return ""
+		}
+		found := false
+		for i := 0; i < value.NumField(); i++ {
+			tag, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+			if tag == name {
+				value, found = value.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return ""
+		}
+	}
+	if value.Kind() != reflect.String {
+		return ""
+	}
+	return value.String()
+}
+
+// partitionKey returns the partition key of a marshalled event, for payloads
+// that may not be a valid EventMessage, see eventPartitionKey
+func partitionKey(data []byte) []byte {
+	if len(PartitionKeyFields) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil
+	}
+	for _, field := range PartitionKeyFields {
+		switch value := LookupField(doc, field).(type) {
+		case string:
+			if value != "" {
+				return []byte(value)
+			}
+		case json.Number:
+			return []byte(value.String())
+		}
+	}
+	return nil
+}
+
+// LookupField returns the value found at the dotted path of a decoded JSON
+// document, nil when there is none
+func LookupField(doc map[string]interface{}, path string) interface{} {
+	var value interface{} = doc
+	for _, name := range strings.Split(path, ".") {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = fields[name]
+	}
+	return value
+}
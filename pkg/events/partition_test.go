@@ -0,0 +1,95 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPartitionKey(t *testing.T) {
+	type testStruct struct {
+		fields  []string
+		payload string
+		expKey  string
+	}
+	var testCases = []testStruct{
+		{nil, `{"loan_meta_data":{"loan_application_id":"la-1","customer_id":"c-1"},"user":"u-1"}`, ""},
+		{[]string{"loan_meta_data.loan_application_id", "loan_meta_data.customer_id", "user"}, `{"loan_meta_data":{"loan_application_id":"la-1","customer_id":"c-1"},"user":"u-1"}`, "la-1"},
+		{[]string{"loan_meta_data.loan_application_id", "loan_meta_data.customer_id", "user"}, `{"loan_meta_data":{"loan_application_id":"","customer_id":"c-1"},"user":"u-1"}`, "c-1"},
+		{[]string{"loan_meta_data.loan_application_id", "loan_meta_data.customer_id", "user"}, `{"loan_meta_data":{},"user":"u-1"}`, "u-1"},
+		{[]string{"loan_meta_data.loan_application_id", "loan_meta_data.customer_id", "user"}, `{"loan_meta_data":"la-1"}`, ""},
+		{[]string{"account.id"}, `{"account":{"id":12345678901234567890}}`, "12345678901234567890"},
+		{[]string{"user"}, `not json`, ""},
+	}
+	defer func(fields []string) { PartitionKeyFields = fields }(PartitionKeyFields)
+	for index, test := range testCases {
+		PartitionKeyFields = test.fields
+		key := string(partitionKey([]byte(test.payload)))
+		if key != test.expKey {
+			t.Errorf("Case %d: partitionKey Error: (expected: %s, got: %s)", index+1, test.expKey, key)
+		}
+	}
+}
+
+func TestEventPartitionKey(t *testing.T) {
+	event := EventMessage{EventType: "click", User: "u-1", LoanMetaData: LoanMetaData{CustomerID: "c-1"}}
+	type testStruct struct {
+		fields []string
+		event  EventMessage
+		expKey string
+	}
+	var testCases = []testStruct{
+		{nil, event, ""},
+		{[]string{"loan_meta_data.loan_application_id", "loan_meta_data.customer_id", "user"}, event, "c-1"},
+		{[]string{"loan_meta_data.loan_application_id", "user"}, event, "u-1"},
+		{[]string{"event_type"}, event, "click"},
+		// paths that are not strings of the event are skipped
+		{[]string{"loan_meta_data", "user.id", "account.id", "user"}, event, "u-1"},
+		{[]string{"user"}, EventMessage{}, ""},
+	}
+	defer func(fields []string) { PartitionKeyFields = fields }(PartitionKeyFields)
+	for index, test := range testCases {
+		PartitionKeyFields = test.fields
+		key := string(eventPartitionKey(test.event))
+		if key != test.expKey {
+			t.Errorf("Case %d: eventPartitionKey Error: (expected: %s, got: %s)", index+1, test.expKey, key)
+		}
+		// the key is the one of the marshalled event
+		data, _ := json.Marshal(test.event)
+		if payloadKey := string(partitionKey(data)); payloadKey != key {
+			t.Errorf("Case %d: partitionKey Error: (expected: %s, got: %s)", index+1, key, payloadKey)
+		}
+	}
+}
+
+func TestBatchRecord(t *testing.T) {
+	batch := []Message{
+		{Key: []byte("la-1"), Value: []byte(`{"event_type":"a"}`)},
+		{Value: []byte(`{"event_type":"b"}`)},
+	}
+	route, decoded, err := decodeBatch(encodeBatch("audit", batch))
+	if err != nil {
+		t.Fatalf("decodeBatch Error: (expected: nil, got: %s)", err.Error())
+	}
+	if route != "audit" {
+		t.Errorf("decodeBatch Error: route (expected: audit, got: %s)", route)
+	}
+	if len(decoded) != len(batch) {
+		t.Fatalf("decodeBatch Error: messages (expected: %d, got: %d)", len(batch), len(decoded))
+	}
+	for index, message := range batch {
+		if string(decoded[index].Key) != string(message.Key) || string(decoded[index].Value) != string(message.Value) {
+			t.Errorf("Case %d: decodeBatch Error: (expected: %s %s, got: %s %s)", index+1,
+				message.Key, message.Value, decoded[index].Key, decoded[index].Value)
+		}
+	}
+	if decoded[1].Key != nil {
+		t.Errorf("decodeBatch Error: empty key (expected: nil, got: %q)", decoded[1].Key)
+	}
+
+	// records written before partition keys were added carry values only
+	legacy := []byte{batchVersionRoute, 5, 'a', 'u', 'd', 'i', 't', 2, '{', '}'}
+	route, decoded, err = decodeBatch(legacy)
+	if err != nil || route != "audit" || len(decoded) != 1 || string(decoded[0].Value) != "{}" {
+		t.Errorf("decodeBatch Error: legacy record (expected: audit {}, got: %s %v %v)", route, decoded, err)
+	}
+}
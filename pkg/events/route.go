@@ -0,0 +1,81 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// DefaultRoute is taken by events no route of EventRoutes matches, it writes to EventSink
+const DefaultRoute = "default"
+
+// Route sends the events it matches to its own sink. Patterns use path.Match
+// syntax, e.g. "ui_*", and an empty pattern matches anything.
+type Route struct {
+	Name       string
+	EventType  string
+	Source     string
+	ObjectType string
+	Sink       Sink
+}
+
+// EventRoutes are tried in order, the first match decides where an event goes
+var EventRoutes []Route
+
+// Validate checks the route is usable, a route has to match on at least one field
+func (r Route) Validate() error {
+	if r.Name == "" || r.Name == DefaultRoute {
+		return fmt.Errorf("events: invalid route name %q", r.Name)
+	}
+	if r.EventType == "" && r.Source == "" && r.ObjectType == "" {
+		return fmt.Errorf("events: route %q matches every event", r.Name)
+	}
+	if r.Sink == nil {
+		return fmt.Errorf("events: route %q has no sink", r.Name)
+	}
+	for _, pattern := range []string{r.EventType, r.Source, r.ObjectType} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("events: route %q has an invalid pattern %q: %w", r.Name, pattern, err)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the event matches every pattern of the route
+func (r Route) Match(event EventMessage) bool {
+	return matchPattern(r.EventType, event.EventType) &&
+		matchPattern(r.Source, event.Source) &&
+		matchPattern(r.ObjectType, event.ObjectType)
+}
+
+func matchPattern(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// routeEvent returns the name of the route the event is sent through
+func routeEvent(event EventMessage) string {
+	for _, route := range EventRoutes {
+		if route.Match(event) {
+			return route.Name
+		}
+	}
+	return DefaultRoute
+}
+
+// routeSink returns the sink of a route, a route that is no longer configured
+// falls back to EventSink so that batches logged before a config change still ship
+func routeSink(name string) (Sink, error) {
+	for _, route := range EventRoutes {
+		if route.Name == name {
+			return route.Sink, nil
+		}
+	}
+	if EventSink == nil {
+		return nil, errors.New("events: no sink configured")
+	}
+	return EventSink, nil
+}
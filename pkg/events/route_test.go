@@ -0,0 +1,133 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRouteValidate(t *testing.T) {
+	sink := NewMemorySink()
+	type testStruct struct {
+		route  Route
+		expErr bool
+	}
+	var testCases = []testStruct{
+		{Route{Name: "ui", EventType: "ui_*", Sink: sink}, false},
+		{Route{Name: "loans", Source: "loan-service", ObjectType: "loan", Sink: sink}, false},
+		{Route{EventType: "ui_*", Sink: sink}, true},
+		{Route{Name: DefaultRoute, EventType: "ui_*", Sink: sink}, true},
+		{Route{Name: "all", Sink: sink}, true},
+		{Route{Name: "ui", EventType: "ui_*"}, true},
+		{Route{Name: "ui", EventType: "ui_[", Sink: sink}, true},
+	}
+	for index, test := range testCases {
+		if err := test.route.Validate(); (err != nil) != test.expErr {
+			t.Errorf("Case %d: Validate Error: (expected error: %t, got: %v)", index+1, test.expErr, err)
+		}
+	}
+}
+
+func TestRouteEvent(t *testing.T) {
+	defer func() { EventRoutes = nil }()
+	EventRoutes = []Route{
+		{Name: "ui", EventType: "ui_*"},
+		{Name: "loan-ui", EventType: "ui_*", ObjectType: "loan"},
+		{Name: "loans", Source: "loan-*", ObjectType: "loan"},
+		{Name: "audit", EventType: "audit"},
+	}
+	type testStruct struct {
+		event    EventMessage
+		expRoute string
+	}
+	var testCases = []testStruct{
+		{EventMessage{EventType: "ui_click"}, "ui"},
+		// routes are tried in order, the first match wins
+		{EventMessage{EventType: "ui_click", ObjectType: "loan"}, "ui"},
+		{EventMessage{EventType: "update", Source: "loan-service", ObjectType: "loan"}, "loans"},
+		// every pattern of a route has to match
+		{EventMessage{EventType: "update", Source: "loan-service", ObjectType: "customer"}, DefaultRoute},
+		{EventMessage{EventType: "update", ObjectType: "loan"}, DefaultRoute},
+		{EventMessage{EventType: "audit"}, "audit"},
+		{EventMessage{EventType: "audit_log"}, DefaultRoute},
+		{EventMessage{}, DefaultRoute},
+	}
+	for index, test := range testCases {
+		if route := routeEvent(test.event); route != test.expRoute {
+			t.Errorf("Case %d: routeEvent Error: (expected: %s, got: %s)", index+1, test.expRoute, route)
+		}
+	}
+}
+
+func TestRouteSink(t *testing.T) {
+	defer func() { EventSink, EventRoutes = nil, nil }()
+	defaultSink, uiSink := NewMemorySink(), NewMemorySink()
+	EventRoutes = []Route{{Name: "ui", EventType: "ui_*", Sink: uiSink}}
+
+	type testStruct struct {
+		eventSink Sink
+		route     string
+		expSink   Sink
+		expErr    bool
+	}
+	var testCases = []testStruct{
+		{defaultSink, "ui", uiSink, false},
+		{defaultSink, DefaultRoute, defaultSink, false},
+		// a route that is no longer configured ships to EventSink
+		{defaultSink, "removed", defaultSink, false},
+		{nil, "ui", uiSink, false},
+		{nil, DefaultRoute, nil, true},
+	}
+	for index, test := range testCases {
+		EventSink = test.eventSink
+		sink, err := routeSink(test.route)
+		if (err != nil) != test.expErr {
+			t.Errorf("Case %d: routeSink Error: (expected error: %t, got: %v)", index+1, test.expErr, err)
+		}
+		if sink != test.expSink {
+			t.Errorf("Case %d: routeSink Error: (expected: %v, got: %v)", index+1, test.expSink, sink)
+		}
+	}
+}
+
+func TestPipelineRoutes(t *testing.T) {
+	defaultSink := startPipeline(t, BatchConfig{MaxEvents: 100, MaxBytes: 1 << 20, Interval: time.Millisecond, Workers: 1, QueueSize: 10})
+	uiSink := NewMemorySink()
+	EventRoutes = []Route{{Name: "ui", EventType: "ui_*", Sink: uiSink}}
+	defer func() { EventRoutes = nil }()
+
+	for _, eventType := range []string{"ui_click", "loan_update", "ui_scroll"} {
+		if err := TrigerEvent(EventMessage{EventType: eventType}, nil); err != nil {
+			t.Fatalf("TrigerEvent Error: (expected: nil, got: %s)", err.Error())
+		}
+	}
+	Shutdown(context.Background())
+
+	type testStruct struct {
+		sink      *MemorySink
+		expEvents []string
+	}
+	var testCases = []testStruct{
+		{uiSink, []string{"ui_click", "ui_scroll"}},
+		{defaultSink, []string{"loan_update"}},
+	}
+	for index, test := range testCases {
+		var got []string
+		for _, message := range test.sink.Messages() {
+			var event EventMessage
+			json.Unmarshal(message.Value, &event)
+			got = append(got, event.EventType)
+		}
+		if len(got) != len(test.expEvents) {
+			t.Errorf("Case %d: routed events Error: (expected: %v, got: %v)", index+1, test.expEvents, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expEvents[i] {
+				t.Errorf("Case %d: routed events Error: (expected: %v, got: %v)", index+1, test.expEvents, got)
+				break
+			}
+		}
+	}
+}
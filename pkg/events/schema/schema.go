@@ -0,0 +1,174 @@
+// Package schema validates events against the JSON Schema registered for their
+// event type and version. Schemas are loaded from files named
+// <event_type>.v<version>.json, an event without a schema_version is validated
+// against the latest version of its type.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var (
+	ErrorUnknownEventType = errors.New("schema: no schema registered for event type")
+	ErrorUnknownVersion   = errors.New("schema: no schema registered for version")
+	ErrorMissingEventType = errors.New("schema: event_type is missing")
+)
+
+const resourcePrefix = "mem://schemas/"
+
+var fileName = regexp.MustCompile(`^(.+)\.v([0-9]+)\.json$`)
+
+// Registry maps event types and versions to their compiled schema
+type Registry struct {
+	schemas  map[string]map[string]*jsonschema.Schema
+	latest   map[string]string
+	required bool // reject event types without a schema
+
+	mu       sync.Mutex
+	rejected map[string]int64
+}
+
+var registry = &Registry{rejected: make(map[string]int64)}
+
+// Init loads the schemas of dir into the registry used by Validate. With
+// required set, events of a type that has no schema are rejected, otherwise
+// they pass through unchecked.
+func Init(dir string, required bool) error {
+	r, err := Load(dir)
+	if err != nil {
+		return err
+	}
+	r.required = required
+	registry = r
+	return nil
+}
+
+// Validate validates an event payload against the registry set up by Init
+func Validate(payload []byte) error {
+	return registry.Validate(payload)
+}
+
+// Rejected returns the number of events rejected by the registry set up by Init, per event type
+func Rejected() map[string]int64 {
+	return registry.Rejected()
+}
+
+// Load compiles every schema file of dir, a missing dir gives an empty registry
+func Load(dir string) (*Registry, error) {
+	r := &Registry{
+		schemas:  make(map[string]map[string]*jsonschema.Schema),
+		latest:   make(map[string]string),
+		rejected: make(map[string]int64),
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		eventType, version := match[1], match[2]
+		path := filepath.Join(dir, entry.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		// schemas are registered under their file name rather than their path,
+		// the url shows up in the validation errors sent back to clients
+		url := resourcePrefix + entry.Name()
+		err = compiler.AddResource(url, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("schema: couldn't read %s: %w", path, err)
+		}
+		compiled, err := compiler.Compile(url)
+		if err != nil {
+			return nil, fmt.Errorf("schema: couldn't compile %s: %w", path, err)
+		}
+		if r.schemas[eventType] == nil {
+			r.schemas[eventType] = make(map[string]*jsonschema.Schema)
+		}
+		r.schemas[eventType][version] = compiled
+		if latest, ok := r.latest[eventType]; !ok || newer(version, latest) {
+			r.latest[eventType] = version
+		}
+	}
+	return r, nil
+}
+
+// Validate checks the payload against the schema of its event_type and schema_version
+func (r *Registry) Validate(payload []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+	fields, _ := doc.(map[string]interface{})
+	eventType, _ := fields["event_type"].(string)
+	version, _ := fields["schema_version"].(string)
+
+	err := r.validate(doc, eventType, version)
+	if err != nil {
+		r.mu.Lock()
+		r.rejected[eventType]++
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *Registry) validate(doc interface{}, eventType string, version string) error {
+	versions, ok := r.schemas[eventType]
+	if !ok {
+		if !r.required {
+			return nil
+		}
+		if eventType == "" {
+			return ErrorMissingEventType
+		}
+		return fmt.Errorf("%w %q", ErrorUnknownEventType, eventType)
+	}
+	if version == "" {
+		version = r.latest[eventType]
+	}
+	compiled, ok := versions[version]
+	if !ok {
+		return fmt.Errorf("%w %q of %q", ErrorUnknownVersion, version, eventType)
+	}
+	return compiled.Validate(doc)
+}
+
+// Rejected returns the number of rejected events per event type
+func (r *Registry) Rejected() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make(map[string]int64, len(r.rejected))
+	for eventType, count := range r.rejected {
+		result[eventType] = count
+	}
+	return result
+}
+
+func newer(a string, b string) bool {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return x > y
+}
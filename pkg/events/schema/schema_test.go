@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const pageViewV1 = `{
+	"type": "object",
+	"required": ["event_type", "screen"],
+	"properties": {
+		"event_type": {"const": "page_view"},
+		"schema_version": {"type": "string"},
+		"screen": {"type": "string", "minLength": 1},
+		"timestamp": {"type": "string", "format": "date-time"}
+	},
+	"additionalProperties": false
+}`
+
+const pageViewV2 = `{
+	"type": "object",
+	"required": ["event_type", "screen", "timestamp"],
+	"properties": {
+		"event_type": {"const": "page_view"},
+		"schema_version": {"type": "string"},
+		"screen": {"type": "string", "minLength": 1},
+		"timestamp": {"type": "string", "format": "date-time"}
+	}
+}`
+
+func loadRegistry(t *testing.T, required bool) *Registry {
+	dir := t.TempDir()
+	files := map[string]string{
+		"page_view.v1.json": pageViewV1,
+		"page_view.v2.json": pageViewV2,
+		"README.md":         "not a schema",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load Error: (expected: nil, got: %s)", err.Error())
+	}
+	r.required = required
+	return r
+}
+
+func TestValidate(t *testing.T) {
+	type testStruct struct {
+		payload  string
+		required bool
+		valid    bool
+		expErr   error
+	}
+	var testCases = []testStruct{
+		{`{"event_type":"page_view","screen":"home","timestamp":"2024-06-01T10:00:00Z"}`, false, true, nil},    // latest version
+		{`{"event_type":"page_view","screen":"home"}`, false, false, nil},                                      // latest needs timestamp
+		{`{"event_type":"page_view","schema_version":"1","screen":"home"}`, false, true, nil},                  // v1 doesn't
+		{`{"event_type":"page_view","schema_version":"1","screen":"home","extra":"x"}`, false, false, nil},     // unknown field in v1
+		{`{"event_type":"page_view","screen":"home","timestamp":"yesterday"}`, false, false, nil},              // free text timestamp
+		{`{"event_type":"page_view","schema_version":"3","screen":"home"}`, false, false, ErrorUnknownVersion}, // unknown version
+		{`{"event_type":"click","screen":"home"}`, false, true, nil},                                           // no schema, not required
+		{`{"event_type":"click","screen":"home"}`, true, false, ErrorUnknownEventType},                         // no schema, required
+		{`{"screen":"home"}`, true, false, ErrorMissingEventType},                                              // no event type, required
+		{`not json`, false, false, nil},
+	}
+	for index, test := range testCases {
+		r := loadRegistry(t, test.required)
+		err := r.Validate([]byte(test.payload))
+		if test.valid {
+			if err != nil {
+				t.Errorf("Case %d: Validate Error: (expected: nil, got: %s)", index+1, err.Error())
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Case %d: Validate Error: (expected: error, got: nil)", index+1)
+			continue
+		}
+		if test.expErr != nil && !errors.Is(err, test.expErr) {
+			t.Errorf("Case %d: Validate Error: (expected: %v, got: %v)", index+1, test.expErr, err)
+		}
+	}
+}
+
+func TestRejectedCount(t *testing.T) {
+	r := loadRegistry(t, false)
+	r.Validate([]byte(`{"event_type":"page_view"}`))
+	r.Validate([]byte(`{"event_type":"page_view"}`))
+	r.Validate([]byte(`{"event_type":"page_view","screen":"home","timestamp":"2024-06-01T10:00:00Z"}`))
+	if count := r.Rejected()["page_view"]; count != 2 {
+		t.Errorf("Rejected count: (expected: 2, got: %d)", count)
+	}
+}
+
+func TestLoadShippedSchemas(t *testing.T) {
+	if _, err := Load("../../../conf/schemas"); err != nil {
+		t.Errorf("Load Error: (expected: nil, got: %s)", err.Error())
+	}
+}
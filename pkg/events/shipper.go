@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+var (
+	shipMinBackoff = 500 * time.Millisecond
+	shipMaxBackoff = 30 * time.Second
+)
+
+// pendingDones holds the delivery callbacks of batches appended to EventLog,
+// keyed by record seq, until the shipper writes them to the sink
+var pendingDones = struct {
+	sync.Mutex
+	m map[uint64][]func(error)
+}{m: make(map[uint64][]func(error))}
+
+// logBatch appends the batch of a route to EventLog, the shipper delivers it to the sink from there
+func logBatch(route string, queued []QueuedEvent, batch []Message) error {
+	seq, err := EventLog.Append(encodeBatch(route, batch))
+	if err != nil {
+		return err
+	}
+	var dones []func(error)
+	for _, event := range queued {
+		if event.Done != nil {
+			dones = append(dones, event.Done)
+		}
+	}
+	if len(dones) > 0 {
+		pendingDones.Lock()
+		pendingDones.m[seq] = dones
+		pendingDones.Unlock()
+	}
+	return nil
+}
+
+// shipEvents replays the records of EventLog to the sink in order until ctx
+// is cancelled. A batch the sink keeps failing is dead-lettered, and while
+// the dead letter sink is failing as well the record stays in the log and is
+// retried. Records left over by a previous run are shipped first.
+func shipEvents(ctx context.Context) {
+	for {
+		rec, err := EventLog.Next(ctx)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Errorf("[shipEvents] failed to read event log. err: %v", err)
+			}
+			return
+		}
+		route, batch, err := decodeBatch(rec.Data)
+		if err != nil {
+			log.Errorf("[shipEvents] dropping undecodable record %d. err: %v", rec.Seq, err)
+		} else {
+			err = shipBatch(ctx, route, batch)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		if err := EventLog.Ack(rec.Seq); err != nil {
+			log.Errorf("[shipEvents] failed to ack record %d. err: %v", rec.Seq, err)
+		}
+		pendingDones.Lock()
+		dones := pendingDones.m[rec.Seq]
+		delete(pendingDones.m, rec.Seq)
+		pendingDones.Unlock()
+		for _, done := range dones {
+			done(err)
+		}
+	}
+}
+
+// shipBatch delivers the batch until either the sink or the dead letter sink
+// takes it, it only gives up when ctx is cancelled
+func shipBatch(ctx context.Context, route string, batch []Message) error {
+	for {
+		err := deliverBatch(ctx, route, batch)
+		if err == nil || errors.Is(err, ErrorDeadLettered) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(shipMaxBackoff):
+		}
+	}
+}
+
+// Versions of the batch records written to EventLog, given by their first byte.
+// Records of version 1 carry no partition keys and are still read.
+const (
+	batchVersionRoute = 1
+	batchVersionKeys  = 2
+)
+
+// encodeBatch writes the version and the route of the batch, followed by the
+// key and the value of every message, each framed with its uvarint length
+func encodeBatch(route string, batch []Message) []byte {
+	size := 1 + binary.MaxVarintLen64 + len(route)
+	for _, message := range batch {
+		size += 2*binary.MaxVarintLen64 + len(message.Key) + len(message.Value)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, batchVersionKeys)
+	buf = appendField(buf, []byte(route))
+	for _, message := range batch {
+		buf = appendField(buf, message.Key)
+		buf = appendField(buf, message.Value)
+	}
+	return buf
+}
+
+func appendField(buf []byte, field []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(field)))
+	return append(buf, field...)
+}
+
+func decodeBatch(buf []byte) (string, []Message, error) {
+	if len(buf) == 0 || (buf[0] != batchVersionRoute && buf[0] != batchVersionKeys) {
+		return "", nil, errors.New("events: unknown batch record version")
+	}
+	version := buf[0]
+	var fields [][]byte
+	for buf = buf[1:]; len(buf) > 0; {
+		length, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < length {
+			return "", nil, errors.New("events: malformed batch record")
+		}
+		fields = append(fields, buf[n:n+int(length)])
+		buf = buf[n+int(length):]
+	}
+	if len(fields) == 0 || (version == batchVersionKeys && len(fields)%2 == 0) {
+		return "", nil, errors.New("events: malformed batch record")
+	}
+	route, fields := string(fields[0]), fields[1:]
+	var batch []Message
+	for len(fields) > 0 {
+		if version == batchVersionRoute {
+			batch = append(batch, Message{Value: fields[0]})
+			fields = fields[1:]
+			continue
+		}
+		var key []byte
+		if len(fields[0]) > 0 {
+			key = fields[0]
+		}
+		batch = append(batch, Message{Key: key, Value: fields[1]})
+		fields = fields[2:]
+	}
+	return route, batch, nil
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// drainPoll is how often Shutdown checks whether EventLog is shipped
+const drainPoll = 50 * time.Millisecond
+
+// Shutdown stops queueing events and drains the pipeline for as long as ctx
+// allows: queued and batched events are flushed and the sink writes in flight
+// are waited for. With EventLog set it also waits for the log to be shipped,
+// records still in it are shipped on the next start. Writes are given up once
+// ctx is done, and the sinks and EventLog are closed. Calls after the first
+// one do nothing.
+func Shutdown(ctx context.Context) error {
+	queue.Lock()
+	if queue.closed {
+		queue.Unlock()
+		return nil
+	}
+	queue.closed = true
+	queue.Unlock()
+	close(Done)
+
+	err := drain(ctx)
+	cancelPipeline()
+	writing.Wait()
+	shipping.Wait()
+
+	return errors.Join(err, closeSinks())
+}
+
+func drain(ctx context.Context) error {
+	written := make(chan struct{})
+	go func() {
+		writing.Wait()
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-ctx.Done():
+		return fmt.Errorf("events: gave up waiting for sink writes: %w", ctx.Err())
+	}
+	if EventLog == nil {
+		return nil
+	}
+
+	ticker := time.NewTicker(drainPoll)
+	defer ticker.Stop()
+	for EventLog.Pending() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Infof("[Shutdown] %d batches left in the event log, they are shipped on the next start", EventLog.Pending())
+			return nil
+		}
+	}
+	return nil
+}
+
+// closeSinks closes every sink of the pipeline and EventLog
+func closeSinks() error {
+	var errs []error
+	for _, sink := range pipelineSinks() {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if EventLog != nil {
+		if err := EventLog.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
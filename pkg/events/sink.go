@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Sink types supported by NewSink
+const (
+	SinkKafka  = "kafka"
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkMemory = "memory"
+)
+
+var ErrorSinkClosed = errors.New("events: sink is closed")
+
+// Message is a marshalled event on its way to a sink
+type Message struct {
+	Key   []byte // optional, messages sharing a key keep their order on kafka
+	Value []byte
+}
+
+// Sink is a destination for batches of marshalled events
+type Sink interface {
+	// Write delivers a batch, it returns once the batch is accepted by the destination
+	Write(ctx context.Context, batch []Message) error
+	// Flush pushes out anything the sink has buffered
+	Flush(ctx context.Context) error
+	// Close flushes and releases the sink, it cannot be written to afterwards
+	Close() error
+}
+
+// Checker is implemented by sinks that can tell whether their destination is reachable
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// SinkConfig holds the settings used by NewSink, only the ones for Type are read
+type SinkConfig struct {
+	Type         string
+	KafkaBrokers []string
+	KafkaTopic   string
+	FilePath     string
+}
+
+// NewSink creates the sink described by cfg
+func NewSink(cfg SinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case SinkKafka:
+		if len(cfg.KafkaBrokers) == 0 || cfg.KafkaTopic == "" {
+			return nil, errors.New("events: kafka sink needs brokers and a topic")
+		}
+		return NewKafkaSink(cfg.KafkaBrokers, cfg.KafkaTopic), nil
+	case SinkStdout:
+		return NewStdoutSink(), nil
+	case SinkFile:
+		if cfg.FilePath == "" {
+			return nil, errors.New("events: file sink needs a path")
+		}
+		return NewFileSink(cfg.FilePath)
+	case SinkMemory:
+		return NewMemorySink(), nil
+	}
+	return nil, fmt.Errorf("events: unknown sink type %q", cfg.Type)
+}
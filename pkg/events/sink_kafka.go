@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// KafkaSink writes batches to a kafka topic. Messages are spread across the
+// partitions by the hash of their key, so that the events of a key are read
+// back in the order they were written.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(brokers...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+		},
+	}
+}
+
+// Check fetches the metadata of the topic, which needs a reachable broker
+func (s *KafkaSink) Check(ctx context.Context) error {
+	client := &kafka.Client{Addr: s.writer.Addr}
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{s.writer.Topic}})
+	if err != nil {
+		return err
+	}
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			return fmt.Errorf("topic %s: %w", topic.Name, topic.Error)
+		}
+	}
+	return nil
+}
+
+func (s *KafkaSink) Write(ctx context.Context, batch []Message) error {
+	return s.writer.WriteMessages(ctx, byteTokafkaMessage(batch)...)
+}
+
+// Flush is a no-op, the writer is synchronous so Write returns after the batch is acknowledged
+func (s *KafkaSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+func byteTokafkaMessage(batch []Message) []kafka.Message {
+	var kafkaMessages []kafka.Message
+	for _, message := range batch {
+		kafkaMessages = append(kafkaMessages, kafka.Message{
+			Key:   message.Key,
+			Value: message.Value,
+		})
+
+	}
+	return kafkaMessages
+}
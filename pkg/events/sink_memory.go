@@ -0,0 +1,57 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySink keeps every written event in memory, meant for tests and local runs
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []Message
+	closed   bool
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Write(ctx context.Context, batch []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrorSinkClosed
+	}
+	for _, message := range batch {
+		s.messages = append(s.messages, Message{
+			Key:   append([]byte(nil), message.Key...),
+			Value: append([]byte(nil), message.Value...),
+		})
+	}
+	return nil
+}
+
+func (s *MemorySink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// Messages returns a copy of the events written so far
+func (s *MemorySink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset drops the events written so far
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WriterSink writes every event of a batch as a line of newline-delimited JSON, keys are left out
+type WriterSink struct {
+	mu     sync.Mutex
+	buf    *bufio.Writer
+	file   *os.File // set when the sink owns a file that needs syncing and closing
+	closed bool
+}
+
+// NewStdoutSink returns a sink printing events to stdout
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// NewWriterSink returns a sink writing events to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{buf: bufio.NewWriter(w)}
+}
+
+// NewFileSink returns a sink appending events to the file at path, creating it if needed
+func NewFileSink(path string) (*WriterSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{buf: bufio.NewWriter(f), file: f}, nil
+}
+
+func (s *WriterSink) Write(ctx context.Context, batch []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrorSinkClosed
+	}
+	for _, message := range batch {
+		if _, err := s.buf.Write(message.Value); err != nil {
+			return err
+		}
+		if err := s.buf.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+func (s *WriterSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrorSinkClosed
+	}
+	return s.flush()
+}
+
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.flush()
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (s *WriterSink) flush() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,509 @@
+// Package wal is an append-only segmented log on local disk. Batches of events
+// are appended before they are shipped to the sink, and stay on disk until the
+// shipper acks them, so that an unavailable sink or a restart doesn't lose them.
+package wal
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorClosed   = errors.New("wal: log is closed")
+	ErrorFull     = errors.New("wal: log has reached its size limit")
+	ErrorTooLarge = errors.New("wal: record is larger than the size limit")
+)
+
+const (
+	segmentExt = ".wal"
+	cursorFile = "cursor"
+	// header is crc32 (4) | data length (4) | seq (8) | timestamp in unix nanos (8)
+	headerSize = 24
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Options bound the log on disk
+type Options struct {
+	SegmentSize int64         // a new segment is started once the active one exceeds this size
+	MaxBytes    int64         // Append fails with ErrorFull once the log holds this many bytes, 0 means no limit
+	MaxAge      time.Duration // records older than this are dropped instead of read, 0 means no limit
+}
+
+// Record is an entry of the log
+type Record struct {
+	Seq       uint64
+	Timestamp time.Time
+	Data      []byte
+}
+
+type segment struct {
+	path     string
+	firstSeq uint64
+	lastSeq  uint64 // 0 while the segment is empty
+	size     int64
+}
+
+// Log is safe for concurrent appends, records are read by a single reader through Next
+type Log struct {
+	mu        sync.Mutex
+	dir       string
+	opts      Options
+	segments  []*segment // ordered by firstSeq, the last one is the active segment
+	active    *os.File
+	size      int64
+	nextSeq   uint64
+	committed uint64              // every record up to this seq is acked
+	acked     map[uint64]struct{} // records acked out of order above committed
+	notify    chan struct{}       // closed and replaced on every append
+	closed    bool
+
+	// reader state
+	readFile *os.File
+	readSeg  uint64 // firstSeq of the segment readFile belongs to
+	readOff  int64
+	dropped  int64
+}
+
+// Open opens the log in dir, creating it if needed. A torn record at the end
+// of a segment, as left by a crash during append, is truncated away.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 16 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &Log{
+		dir:    dir,
+		opts:   opts,
+		acked:  make(map[uint64]struct{}),
+		notify: make(chan struct{}),
+	}
+	if err := l.readCursor(); err != nil {
+		return nil, err
+	}
+	if err := l.loadSegments(); err != nil {
+		return nil, err
+	}
+	l.nextSeq = l.committed + 1
+	if n := len(l.segments); n > 0 {
+		last := l.segments[n-1]
+		if last.lastSeq >= l.nextSeq {
+			l.nextSeq = last.lastSeq + 1
+		} else if last.lastSeq == 0 && last.firstSeq > l.nextSeq {
+			l.nextSeq = last.firstSeq
+		}
+	}
+	l.removeCommittedSegments()
+	return l, nil
+}
+
+// Append writes data as a new record and syncs it to disk before returning its seq
+func (l *Log) Append(data []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, ErrorClosed
+	}
+	recordSize := int64(headerSize + len(data))
+	if l.opts.MaxBytes > 0 {
+		if recordSize > l.opts.MaxBytes {
+			return 0, ErrorTooLarge
+		}
+		if l.size+recordSize > l.opts.MaxBytes {
+			return 0, ErrorFull
+		}
+	}
+	if err := l.prepareActive(); err != nil {
+		return 0, err
+	}
+	seg := l.segments[len(l.segments)-1]
+
+	seq := l.nextSeq
+	buf := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[8:16], seq)
+	binary.BigEndian.PutUint64(buf[16:24], uint64(time.Now().UnixNano()))
+	copy(buf[headerSize:], data)
+	binary.BigEndian.PutUint32(buf[0:4], crc32.Checksum(buf[8:], crcTable))
+
+	if _, err := l.active.WriteAt(buf, seg.size); err != nil {
+		return 0, err
+	}
+	if err := l.active.Sync(); err != nil {
+		return 0, err
+	}
+	seg.size += recordSize
+	seg.lastSeq = seq
+	l.size += recordSize
+	l.nextSeq++
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+	return seq, nil
+}
+
+// Next returns the next unacked record, blocking until one is appended. After a
+// restart it starts again from the first record that wasn't acked.
+func (l *Log) Next(ctx context.Context) (Record, error) {
+	for {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return Record{}, ErrorClosed
+		}
+		rec, ok, err := l.readLocked()
+		notify := l.notify
+		l.mu.Unlock()
+		if err != nil {
+			return Record{}, err
+		}
+		if ok {
+			if l.opts.MaxAge > 0 && time.Since(rec.Timestamp) > l.opts.MaxAge {
+				l.mu.Lock()
+				l.dropped++
+				l.mu.Unlock()
+				if err := l.Ack(rec.Seq); err != nil {
+					return Record{}, err
+				}
+				continue
+			}
+			return rec, nil
+		}
+		select {
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// Ack marks a record as shipped. Segments are removed once all their records are acked.
+func (l *Log) Ack(seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seq <= l.committed {
+		return nil
+	}
+	l.acked[seq] = struct{}{}
+	advanced := false
+	for {
+		if _, ok := l.acked[l.committed+1]; !ok {
+			break
+		}
+		delete(l.acked, l.committed+1)
+		l.committed++
+		advanced = true
+	}
+	if !advanced {
+		return nil
+	}
+	if err := l.writeCursor(); err != nil {
+		return err
+	}
+	l.removeCommittedSegments()
+	return nil
+}
+
+// Size returns the bytes held by the log on disk
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Pending returns the number of records appended but not yet acked
+func (l *Log) Pending() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextSeq - 1 - l.committed - uint64(len(l.acked))
+}
+
+// Dropped returns the number of records dropped for exceeding MaxAge
+func (l *Log) Dropped() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped
+}
+
+// Close releases the files of the log and wakes up a blocked Next
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.notify)
+	var err error
+	if l.active != nil {
+		err = l.active.Close()
+	}
+	if l.readFile != nil {
+		l.readFile.Close()
+	}
+	return err
+}
+
+func (l *Log) prepareActive() error {
+	n := len(l.segments)
+	if l.active != nil && l.segments[n-1].size < l.opts.SegmentSize {
+		return nil
+	}
+	if l.active == nil && n > 0 && l.segments[n-1].size < l.opts.SegmentSize {
+		f, err := os.OpenFile(l.segments[n-1].path, os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		l.active = f
+		return nil
+	}
+	// roll over to a new segment
+	seg := &segment{
+		path:     filepath.Join(l.dir, fmt.Sprintf("%020d%s", l.nextSeq, segmentExt)),
+		firstSeq: l.nextSeq,
+	}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if l.active != nil {
+		l.active.Close()
+	}
+	l.active = f
+	l.segments = append(l.segments, seg)
+	syncDir(l.dir)
+	return nil
+}
+
+// readLocked reads the record at the reader position, ok is false when the reader caught up
+func (l *Log) readLocked() (Record, bool, error) {
+	for {
+		seg := l.readSegment()
+		if seg == nil {
+			return Record{}, false, nil
+		}
+		if l.readOff >= seg.size {
+			if seg == l.segments[len(l.segments)-1] {
+				return Record{}, false, nil
+			}
+			// move on to the following segment
+			l.closeReader()
+			l.readSeg = seg.firstSeq + 1
+			continue
+		}
+		if l.readFile == nil {
+			f, err := os.Open(seg.path)
+			if err != nil {
+				return Record{}, false, err
+			}
+			l.readFile = f
+		}
+		rec, n, err := readRecord(l.readFile, l.readOff, seg.size)
+		if err != nil {
+			return Record{}, false, fmt.Errorf("wal: corrupt record in %s at %d: %w", seg.path, l.readOff, err)
+		}
+		l.readOff += n
+		if rec.Seq <= l.committed {
+			continue
+		}
+		if _, ok := l.acked[rec.Seq]; ok {
+			continue
+		}
+		return rec, true, nil
+	}
+}
+
+// readSegment returns the first segment at or after the reader position
+func (l *Log) readSegment() *segment {
+	for _, seg := range l.segments {
+		if seg.firstSeq == l.readSeg {
+			return seg
+		}
+		if seg.firstSeq > l.readSeg {
+			l.closeReader()
+			l.readSeg = seg.firstSeq
+			return seg
+		}
+	}
+	return nil
+}
+
+func (l *Log) closeReader() {
+	if l.readFile != nil {
+		l.readFile.Close()
+		l.readFile = nil
+	}
+	l.readOff = 0
+}
+
+// removeCommittedSegments deletes the segments whose records are all acked. The
+// active segment goes as well once it holds records and all of them are acked,
+// Append starts a new one, so that a log with MaxBytes up to SegmentSize
+// doesn't stay full.
+func (l *Log) removeCommittedSegments() {
+	kept := l.segments[:0]
+	for i, seg := range l.segments {
+		last := i == len(l.segments)-1
+		if seg.lastSeq > l.committed || (last && seg.lastSeq == 0) {
+			kept = append(kept, seg)
+			continue
+		}
+		if last && l.active != nil {
+			l.active.Close()
+			l.active = nil
+		}
+		if seg.firstSeq == l.readSeg {
+			l.closeReader()
+		}
+		if err := os.Remove(seg.path); err == nil || os.IsNotExist(err) {
+			l.size -= seg.size
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	l.segments = kept
+}
+
+func (l *Log) loadSegments() error {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), segmentExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var firstSeq uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name, segmentExt), "%d", &firstSeq); err != nil {
+			continue
+		}
+		seg := &segment{path: filepath.Join(l.dir, name), firstSeq: firstSeq}
+		if err := scanSegment(seg); err != nil {
+			return err
+		}
+		l.segments = append(l.segments, seg)
+		l.size += seg.size
+	}
+	return nil
+}
+
+// scanSegment finds the last valid record of a segment and truncates anything after it
+func scanSegment(seg *segment) error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var off int64
+	for off < info.Size() {
+		rec, n, err := readRecord(f, off, info.Size())
+		if err != nil {
+			break
+		}
+		seg.lastSeq = rec.Seq
+		off += n
+	}
+	seg.size = off
+	if off < info.Size() {
+		if err := f.Truncate(off); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+	return nil
+}
+
+// readRecord reads the record at off of a segment holding size bytes. A length
+// running past size is taken for a torn tail, before anything is allocated for it.
+func readRecord(f *os.File, off int64, size int64) (Record, int64, error) {
+	var header [headerSize]byte
+	if _, err := f.ReadAt(header[:], off); err != nil {
+		return Record{}, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[4:8])
+	if int64(length) > size-off-headerSize {
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, headerSize-8+int(length))
+	copy(buf, header[8:])
+	if _, err := f.ReadAt(buf[headerSize-8:], off+headerSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, 0, io.ErrUnexpectedEOF
+		}
+		return Record{}, 0, err
+	}
+	if crc32.Checksum(buf, crcTable) != binary.BigEndian.Uint32(header[0:4]) {
+		return Record{}, 0, errors.New("checksum mismatch")
+	}
+	rec := Record{
+		Seq:       binary.BigEndian.Uint64(buf[0:8]),
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(buf[8:16]))),
+		Data:      buf[16:],
+	}
+	return rec, headerSize + int64(length), nil
+}
+
+func (l *Log) readCursor() error {
+	b, err := os.ReadFile(filepath.Join(l.dir, cursorFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(b) != 8 {
+		return fmt.Errorf("wal: cursor file is corrupt")
+	}
+	l.committed = binary.BigEndian.Uint64(b)
+	return nil
+}
+
+// writeCursor persists the committed seq, a rename keeps the file intact if the process dies mid-write
+func (l *Log) writeCursor() error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], l.committed)
+	tmp := filepath.Join(l.dir, cursorFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b[:]); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(l.dir, cursorFile))
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
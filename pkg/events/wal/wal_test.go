@@ -0,0 +1,244 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openLog(t *testing.T, dir string, opts Options) *Log {
+	l, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open Error: (expected: nil, got: %s)", err.Error())
+	}
+	return l
+}
+
+func nextRecord(t *testing.T, l *Log) (Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	return l.Next(ctx)
+}
+
+func TestAppendNextAck(t *testing.T) {
+	l := openLog(t, t.TempDir(), Options{SegmentSize: 64})
+	defer l.Close()
+
+	for i := 1; i <= 5; i++ {
+		seq, err := l.Append([]byte(fmt.Sprintf("batch%d", i)))
+		if err != nil {
+			t.Fatalf("Case %d: Append Error: (expected: nil, got: %s)", i, err.Error())
+		}
+		if seq != uint64(i) {
+			t.Errorf("Case %d: Seq Mismatch: (expected: %d, got: %d)", i, i, seq)
+		}
+	}
+	for i := 1; i <= 5; i++ {
+		rec, err := nextRecord(t, l)
+		if err != nil {
+			t.Fatalf("Case %d: Next Error: (expected: nil, got: %s)", i, err.Error())
+		}
+		if string(rec.Data) != fmt.Sprintf("batch%d", i) {
+			t.Errorf("Case %d: Data Mismatch: (expected: batch%d, got: %s)", i, i, rec.Data)
+		}
+		if err := l.Ack(rec.Seq); err != nil {
+			t.Errorf("Case %d: Ack Error: (expected: nil, got: %s)", i, err.Error())
+		}
+	}
+	// reader caught up, next should block until the deadline
+	if _, err := nextRecord(t, l); err != context.DeadlineExceeded {
+		t.Errorf("Next on empty log: (expected: %v, got: %v)", context.DeadlineExceeded, err)
+	}
+	if l.Pending() != 0 {
+		t.Errorf("Pending: (expected: 0, got: %d)", l.Pending())
+	}
+	// every segment should be removed, the active one included as all its records are acked
+	files, _ := filepath.Glob(filepath.Join(l.dir, "*"+segmentExt))
+	if len(files) != 0 {
+		t.Errorf("Segments after ack: (expected: 0, got: %d)", len(files))
+	}
+}
+
+func TestReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir, Options{SegmentSize: 64})
+	for i := 1; i <= 4; i++ {
+		if _, err := l.Append([]byte(fmt.Sprintf("batch%d", i))); err != nil {
+			t.Fatalf("Case %d: Append Error: (expected: nil, got: %s)", i, err.Error())
+		}
+	}
+	// ack 1 and 3, only 1 is committed as 2 is still pending
+	l.Ack(1)
+	l.Ack(3)
+	l.Close()
+
+	l = openLog(t, dir, Options{SegmentSize: 64})
+	defer l.Close()
+	var got []string
+	for {
+		rec, err := nextRecord(t, l)
+		if err != nil {
+			break
+		}
+		got = append(got, string(rec.Data))
+		l.Ack(rec.Seq)
+	}
+	expected := []string{"batch2", "batch3", "batch4"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Replay Mismatch: (expected: %v, got: %v)", expected, got)
+	}
+	// appends continue the sequence
+	seq, err := l.Append([]byte("batch5"))
+	if err != nil || seq != 5 {
+		t.Errorf("Append after restart: (expected: 5, got: %d, %v)", seq, err)
+	}
+}
+
+func TestTornTailIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir, Options{})
+	l.Append([]byte("batch1"))
+	l.Append([]byte("batch2"))
+	l.Close()
+
+	// simulate a crash half way through writing the second record
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	info, _ := os.Stat(files[0])
+	if err := os.Truncate(files[0], info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	l = openLog(t, dir, Options{})
+	defer l.Close()
+	rec, err := nextRecord(t, l)
+	if err != nil || string(rec.Data) != "batch1" {
+		t.Errorf("Next after truncation: (expected: batch1, got: %s, %v)", rec.Data, err)
+	}
+	if _, err := nextRecord(t, l); err != context.DeadlineExceeded {
+		t.Errorf("Torn record should be dropped: (expected: %v, got: %v)", context.DeadlineExceeded, err)
+	}
+	seq, _ := l.Append([]byte("batch3"))
+	if seq != 2 {
+		t.Errorf("Seq after truncation: (expected: 2, got: %d)", seq)
+	}
+}
+
+func TestCorruptLengthIsTruncated(t *testing.T) {
+	dir := t.TempDir()
+	l := openLog(t, dir, Options{})
+	l.Append([]byte("batch1"))
+	l.Append([]byte("batch2"))
+	l.Close()
+
+	// the length of the second record claims 4 GiB, it must not be allocated
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, err := os.OpenFile(files[0], os.O_RDWR, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, headerSize+6+4)
+	f.Close()
+
+	l = openLog(t, dir, Options{})
+	defer l.Close()
+	rec, err := nextRecord(t, l)
+	if err != nil || string(rec.Data) != "batch1" {
+		t.Errorf("Next after truncation: (expected: batch1, got: %s, %v)", rec.Data, err)
+	}
+	if _, err := nextRecord(t, l); err != context.DeadlineExceeded {
+		t.Errorf("Corrupt record should be dropped: (expected: %v, got: %v)", context.DeadlineExceeded, err)
+	}
+	if info, _ := os.Stat(files[0]); info.Size() != headerSize+6 {
+		t.Errorf("Segment size after truncation: (expected: %d, got: %d)", headerSize+6, info.Size())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	l := openLog(t, t.TempDir(), Options{MaxBytes: 3 * (headerSize + 6), MaxAge: time.Hour})
+	defer l.Close()
+
+	for i := 1; i <= 3; i++ {
+		if _, err := l.Append([]byte("batch" + fmt.Sprint(i))); err != nil {
+			t.Fatalf("Case %d: Append Error: (expected: nil, got: %s)", i, err.Error())
+		}
+	}
+	if _, err := l.Append([]byte("batch4")); err != ErrorFull {
+		t.Errorf("Append over MaxBytes: (expected: %v, got: %v)", ErrorFull, err)
+	}
+	if _, err := l.Append(make([]byte, 4*headerSize)); err != ErrorTooLarge {
+		t.Errorf("Append over MaxBytes: (expected: %v, got: %v)", ErrorTooLarge, err)
+	}
+
+	// age every record past MaxAge, they should be dropped instead of read
+	l.opts.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err := nextRecord(t, l); err != context.DeadlineExceeded {
+		t.Errorf("Next on expired records: (expected: %v, got: %v)", context.DeadlineExceeded, err)
+	}
+	if l.Dropped() != 3 || l.Pending() != 0 {
+		t.Errorf("Expired records: (expected: 3 dropped 0 pending, got: %d dropped %d pending)", l.Dropped(), l.Pending())
+	}
+}
+
+func TestCommittedActiveSegmentIsReclaimed(t *testing.T) {
+	dir := t.TempDir()
+	recordSize := int64(headerSize + 6)
+	// the whole log fits in the active segment, it is never rolled over by size
+	l := openLog(t, dir, Options{SegmentSize: 1 << 20, MaxBytes: 2 * recordSize})
+
+	type testStruct struct {
+		data    string
+		expSeq  uint64
+		expErr  error
+		ack     bool // read and ack the record once appended
+		expSize int64
+	}
+	var testCases = []testStruct{
+		{"batch1", 1, nil, false, recordSize},
+		{"batch2", 2, nil, true, 2 * recordSize},
+		{"batch3", 0, ErrorFull, false, 2 * recordSize},
+	}
+	for index, test := range testCases {
+		seq, err := l.Append([]byte(test.data))
+		if err != test.expErr || seq != test.expSeq {
+			t.Errorf("Case %d: Append Error: (expected: %d %v, got: %d %v)", index+1, test.expSeq, test.expErr, seq, err)
+		}
+		if l.Size() != test.expSize {
+			t.Errorf("Case %d: Size Error: (expected: %d, got: %d)", index+1, test.expSize, l.Size())
+		}
+	}
+
+	// once every record is acked the active segment is removed, the log takes appends again
+	for i := 0; i < 2; i++ {
+		rec, err := nextRecord(t, l)
+		if err != nil {
+			t.Fatalf("Next Error: (expected: nil, got: %s)", err.Error())
+		}
+		l.Ack(rec.Seq)
+	}
+	if l.Size() != 0 {
+		t.Errorf("Size after ack: (expected: 0, got: %d)", l.Size())
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt)); len(files) != 0 {
+		t.Errorf("Segments after ack: (expected: none, got: %v)", files)
+	}
+	seq, err := l.Append([]byte("batch3"))
+	if err != nil || seq != 3 {
+		t.Errorf("Append after ack: (expected: 3, got: %d, %v)", seq, err)
+	}
+	rec, err := nextRecord(t, l)
+	if err != nil || string(rec.Data) != "batch3" {
+		t.Errorf("Next after ack: (expected: batch3, got: %s, %v)", rec.Data, err)
+	}
+	l.Close()
+
+	// the seq goes on after a restart
+	l = openLog(t, dir, Options{SegmentSize: 1 << 20, MaxBytes: 2 * recordSize})
+	defer l.Close()
+	if seq, err := l.Append([]byte("batch4")); err != nil || seq != 4 {
+		t.Errorf("Append after restart: (expected: 4, got: %d, %v)", seq, err)
+	}
+}